@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// States of a circuit breaker.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// breakerStates are the states of hana_exporter_breaker_state.
+var breakerStates = enum{breakerClosed, breakerOpen, breakerHalfOpen}
+
+// Metric descriptors.
+var (
+	breakerStateDesc = newStateSetDesc(exporter, "breaker_state",
+		"State of the circuit breaker of the target, 1 for the current state.", nil)
+	breakerNextRetryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "breaker_next_retry_timestamp_seconds"),
+		"Unix time after which the open circuit breaker of the target lets a probe connect.",
+		nil, nil,
+	)
+)
+
+// BreakerConfig are the settings of the circuit breakers of the targets.
+type BreakerConfig struct {
+	// Failures is the number of consecutive connection failures opening
+	// the breaker, 0 disables the breaker.
+	Failures int
+	// Backoff is how long the breaker stays open the first time, doubled
+	// every time the probe fails up to MaxBackoff, 0 for no limit.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// breaker is the circuit breaker of a target. While open, scrapes fail
+// immediately instead of waiting for the connection timeout of an
+// unreachable host. Once the backoff has passed, a single scrape probes the
+// target: the breaker closes when it connects and opens again otherwise.
+type breaker struct {
+	config BreakerConfig
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	opens     uint
+	nextRetry time.Time
+}
+
+// allow reports whether a scrape may connect to the target.
+func (b *breaker) allow() bool {
+	if b.config.Failures <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.nextRetry) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// A probe is running.
+		return false
+	}
+	return true
+}
+
+// success records a successful connection.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.opens = 0
+}
+
+// failure records a failed connection.
+func (b *breaker) failure() {
+	if b.config.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state != breakerHalfOpen && b.failures < b.config.Failures {
+		return
+	}
+	backoff := b.config.Backoff
+	// Without a limit, the doubling stops short of an overflow.
+	for i := uint(0); i < b.opens && (b.config.MaxBackoff <= 0 || backoff < b.config.MaxBackoff) && backoff <= math.MaxInt64/2; i++ {
+		backoff *= 2
+	}
+	if b.config.MaxBackoff > 0 && backoff > b.config.MaxBackoff {
+		backoff = b.config.MaxBackoff
+	}
+	b.opens++
+	b.state = breakerOpen
+	b.nextRetry = time.Now().Add(backoff)
+}
+
+// collect sends the metrics of the breaker.
+func (b *breaker) collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	state, nextRetry := b.state, b.nextRetry
+	b.mu.Unlock()
+	if state == "" {
+		state = breakerClosed
+	}
+	breakerStates.collect(ch, breakerStateDesc, state)
+	if state == breakerOpen {
+		ch <- prometheus.MustNewConstMetric(breakerNextRetryDesc, prometheus.GaugeValue, timestamp(nextRetry))
+	}
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	b := &breaker{config: BreakerConfig{Failures: 2, Backoff: time.Minute, MaxBackoff: 10 * time.Minute}}
+
+	// elapse lets the backoff of an open breaker pass.
+	elapse := func() {
+		b.mu.Lock()
+		b.nextRetry = time.Now().Add(-time.Second)
+		b.mu.Unlock()
+	}
+	steps := []struct {
+		name  string
+		do    func() bool
+		allow bool
+		state string
+	}{
+		{"first scrape", b.allow, true, ""},
+		{"first failure", func() bool { b.failure(); return b.allow() }, true, ""},
+		{"second failure opens", func() bool { b.failure(); return b.allow() }, false, breakerOpen},
+		{"backoff passed", func() bool { elapse(); return b.allow() }, true, breakerHalfOpen},
+		{"single probe", b.allow, false, breakerHalfOpen},
+		{"failed probe opens", func() bool { b.failure(); return b.allow() }, false, breakerOpen},
+		{"second probe", func() bool { elapse(); return b.allow() }, true, breakerHalfOpen},
+		{"successful probe closes", func() bool { b.success(); return b.allow() }, true, breakerClosed},
+		{"failure after closing", func() bool { b.failure(); return b.allow() }, true, breakerClosed},
+	}
+	for _, step := range steps {
+		if got := step.do(); got != step.allow {
+			t.Errorf("%s: allow = %t, want %t", step.name, got, step.allow)
+		}
+		if b.state != step.state {
+			t.Errorf("%s: state = %q, want %q", step.name, b.state, step.state)
+		}
+	}
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	b := &breaker{config: BreakerConfig{Failures: 1, Backoff: time.Minute, MaxBackoff: 5 * time.Minute}}
+	// The backoff doubles on every failed probe, up to MaxBackoff.
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		start := time.Now()
+		b.failure()
+		backoff := b.nextRetry.Sub(start)
+		if backoff < want || backoff > want+time.Second {
+			t.Errorf("failure %d: backoff %s, want %s", i+1, backoff, want)
+		}
+		b.nextRetry = time.Now().Add(-time.Second)
+		if !b.allow() {
+			t.Fatalf("failure %d: no probe after the backoff", i+1)
+		}
+	}
+
+	// A success resets the backoff.
+	b.success()
+	start := time.Now()
+	b.failure()
+	if backoff := b.nextRetry.Sub(start); backoff > time.Minute+time.Second {
+		t.Errorf("backoff after a success %s, want %s", backoff, time.Minute)
+	}
+}
+
+func TestBreakerBackoffUncapped(t *testing.T) {
+	b := &breaker{config: BreakerConfig{Failures: 1, Backoff: time.Minute}}
+	// Without MaxBackoff, the backoff keeps doubling.
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute} {
+		start := time.Now()
+		b.failure()
+		backoff := b.nextRetry.Sub(start)
+		if backoff < want || backoff > want+time.Second {
+			t.Errorf("failure %d: backoff %s, want %s", i+1, backoff, want)
+		}
+		b.nextRetry = time.Now().Add(-time.Second)
+		if !b.allow() {
+			t.Fatalf("failure %d: no probe after the backoff", i+1)
+		}
+	}
+
+	// Nor does it overflow after many failed probes.
+	b.opens = 100
+	b.failure()
+	if !b.nextRetry.After(time.Now().Add(time.Hour)) {
+		t.Errorf("next retry %s after 100 failed probes, want it far ahead", b.nextRetry)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := &breaker{}
+	for i := 0; i < 10; i++ {
+		b.failure()
+	}
+	if !b.allow() {
+		t.Error("a disabled breaker refuses a scrape")
+	}
+}
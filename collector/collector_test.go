@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// formatMetrics returns metrics as sorted lines, e.g.
+// `hana_test_value{a="1",state="x"} 1`.
+func formatMetrics(t *testing.T, metrics []prometheus.Metric) []string {
+	var lines []string
+	for _, m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		var labels []string
+		for _, label := range pb.Label {
+			labels = append(labels, label.GetName()+`="`+label.GetValue()+`"`)
+		}
+		var value float64
+		switch {
+		case pb.Gauge != nil:
+			value = pb.Gauge.GetValue()
+		case pb.Counter != nil:
+			value = pb.Counter.GetValue()
+		case pb.Untyped != nil:
+			value = pb.Untyped.GetValue()
+		}
+		line := fqNameRE.FindStringSubmatch(m.Desc().String())[1]
+		if len(labels) > 0 {
+			line += "{" + strings.Join(labels, ",") + "}"
+		}
+		lines = append(lines, line+" "+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,340 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hdb "github.com/SAP/go-hdb/driver"
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/common/log"
+)
+
+// defaultApplicationName is the application of the sessions of the
+// exporter, unless configured otherwise.
+const defaultApplicationName = "hana_exporter"
+
+// connectOptions are the settings of the connections to a target. They are
+// comparable, so that a pool can detect changed settings.
+type connectOptions struct {
+	host, user, password string
+	dialTimeout          time.Duration
+	readTimeout          time.Duration
+	fetchSize            int
+	locale               string
+	applicationName      string
+	defaultSchema        string
+	// sessionVariables are the SET statements of the session variables,
+	// sorted and separated by NUL, since a map is not comparable.
+	sessionVariables string
+	databaseName     string
+	// databasePort is the SQL port of the tenant used when its lookup
+	// fails, systemUser and systemPassword log on to SYSTEMDB for the
+	// lookup instead of user and password.
+	databasePort               int
+	systemUser, systemPassword string
+	tls                        config.TLSConfig
+	// tlsModTimes are the modification times of the CA, certificate and
+	// key files, so that the pool is reopened with the files once they
+	// are renewed.
+	tlsModTimes [3]int64
+}
+
+// newConnectOptions returns the connection settings of target from its
+// database config.
+func newConnectOptions(target string, c config.DatabaseConfig) (connectOptions, error) {
+	password, err := c.CurrentPassword()
+	if err != nil {
+		return connectOptions{}, err
+	}
+	o := connectOptions{
+		host:            target,
+		user:            c.User,
+		password:        password,
+		dialTimeout:     c.DialTimeout,
+		readTimeout:     c.ReadTimeout,
+		fetchSize:       c.FetchSize,
+		locale:          c.Locale,
+		applicationName: c.ApplicationName,
+		defaultSchema:   c.DefaultSchema,
+		databaseName:    c.DatabaseName,
+		databasePort:    c.DatabasePort,
+		systemUser:      c.SystemDBUser,
+		systemPassword:  c.SystemDBPassword,
+		tls:             c.TLS,
+	}
+	if o.applicationName == "" {
+		o.applicationName = defaultApplicationName
+	}
+	if c.TLS.Enabled {
+		for i, file := range []string{c.TLS.CAFile, c.TLS.CertFile, c.TLS.KeyFile} {
+			// A file which cannot be read fails the TLS config instead.
+			if info, err := os.Stat(file); file != "" && err == nil {
+				o.tlsModTimes[i] = info.ModTime().UnixNano()
+			}
+		}
+	}
+	names := make([]string, 0, len(c.SessionVariables))
+	for name := range c.SessionVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statements := make([]string, 0, len(names))
+	for _, name := range names {
+		statements = append(statements, fmt.Sprintf("SET '%s' = '%s'", quote(name), quote(c.SessionVariables[name])))
+	}
+	o.sessionVariables = strings.Join(statements, "\x00")
+	return o, nil
+}
+
+// quote escapes the single quotes of s for a string literal.
+func quote(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+// connector returns the driver.Connector opening connections with the
+// options. The credentials are passed as such, so that they need no
+// escaping as in a DSN. The certificate of the server is recorded in cert
+// during the TLS handshakes.
+func (o connectOptions) connector(cert *serverCertificate) (driver.Connector, error) {
+	c, err := o.hdbConnector(o.host, cert)
+	if err != nil {
+		return nil, err
+	}
+	init := []string{fmt.Sprintf("SET 'APPLICATION' = '%s'", quote(o.applicationName))}
+	if o.sessionVariables != "" {
+		init = append(init, strings.Split(o.sessionVariables, "\x00")...)
+	}
+	if o.defaultSchema != "" {
+		init = append(init, fmt.Sprintf(`SET SCHEMA "%s"`, strings.Replace(o.defaultSchema, `"`, `""`, -1)))
+	}
+	sc := &sessionConnector{Connector: c, dialTimeout: o.dialTimeout, init: init}
+	if o.databaseName != "" {
+		if o.systemUser != "" {
+			lookup := o
+			lookup.user, lookup.password = o.systemUser, o.systemPassword
+			if sc.Connector, err = lookup.hdbConnector(o.host, cert); err != nil {
+				return nil, err
+			}
+		}
+		sc.databaseName = o.databaseName
+		if o.databasePort != 0 {
+			sc.databasePort = strconv.Itoa(o.databasePort)
+		}
+		sc.tenantConnector = func(port string) (driver.Connector, error) {
+			host, _, err := net.SplitHostPort(o.host)
+			if err != nil {
+				return nil, err
+			}
+			return o.hdbConnector(net.JoinHostPort(host, port), cert)
+		}
+	}
+	return sc, nil
+}
+
+// hdbConnector returns the driver connector to address with the options.
+func (o connectOptions) hdbConnector(address string, cert *serverCertificate) (*hdb.Connector, error) {
+	c := hdb.NewBasicAuthConnector(address, o.user, o.password)
+	if o.readTimeout > 0 {
+		// The driver timeout is in seconds, round up.
+		if err := c.SetTimeout(int((o.readTimeout + time.Second - 1) / time.Second)); err != nil {
+			return nil, err
+		}
+	}
+	if o.fetchSize > 0 {
+		if err := c.SetFetchSize(o.fetchSize); err != nil {
+			return nil, err
+		}
+	}
+	if o.locale != "" {
+		c.SetLocale(o.locale)
+	}
+	if o.tls.Enabled {
+		tlsConfig, err := o.tlsConfig(cert)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.SetTLSConfig(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// tlsConfig returns the TLS configuration of the connections.
+func (o connectOptions) tlsConfig(cert *serverCertificate) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         o.tls.ServerName,
+		InsecureSkipVerify: o.tls.InsecureSkipVerify,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			// Called after the verification of the chain, if any.
+			if len(rawCerts) > 0 {
+				if leaf, err := x509.ParseCertificate(rawCerts[0]); err == nil {
+					cert.set(leaf)
+				}
+			}
+			return nil
+		},
+	}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(o.host)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ServerName = host
+	}
+	if o.tls.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.tls.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", o.tls.CAFile)
+		}
+	}
+	if o.tls.CertFile != "" || o.tls.KeyFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(o.tls.CertFile, o.tls.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
+
+// serverCertificate records the expiry of the certificate presented by the
+// server in the last TLS handshake. It is concurrency-safe.
+type serverCertificate struct {
+	mu       sync.Mutex
+	notAfter time.Time
+}
+
+// set records the certificate of a handshake.
+func (c *serverCertificate) set(cert *x509.Certificate) {
+	c.mu.Lock()
+	c.notAfter = cert.NotAfter
+	c.mu.Unlock()
+}
+
+// expiry returns when the last seen certificate expires, ok is false if no
+// certificate was seen.
+func (c *serverCertificate) expiry() (notAfter time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.notAfter, !c.notAfter.IsZero()
+}
+
+// tenantPortQuery returns the SQL port of a tenant database, run on
+// SYSTEMDB.
+const tenantPortQuery = `SELECT TOP 1 SQL_PORT FROM SYS_DATABASES.M_SERVICES WHERE DATABASE_NAME = ? AND SQL_PORT <> 0 ORDER BY SQL_PORT`
+
+// sessionConnector opens connections with a dial timeout and initializes
+// their session. It implements driver.Connector.
+type sessionConnector struct {
+	driver.Connector
+	dialTimeout time.Duration
+	// init are the statements run on every new connection.
+	init []string
+
+	// databaseName is the tenant database connected to through the
+	// SYSTEMDB of Connector, if any. tenantConnector returns the connector
+	// to the given SQL port of the tenant, databasePort is the port used
+	// when the lookup on SYSTEMDB fails, if any.
+	databaseName    string
+	databasePort    string
+	tenantConnector func(port string) (driver.Connector, error)
+	mu              sync.Mutex
+	// tenant is the connector to the tenant, looked up again after a
+	// failed connection, so that a moved tenant is followed.
+	tenant driver.Connector
+}
+
+// Connect implements driver.Connector.
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return conn, nil
+	}
+	for _, statement := range c.init {
+		if _, err := execer.ExecContext(ctx, statement, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// connect opens a connection to the target, or to the tenant database.
+func (c *sessionConnector) connect(ctx context.Context) (driver.Conn, error) {
+	if c.databaseName == "" {
+		return c.Connector.Connect(ctx)
+	}
+	c.mu.Lock()
+	tenant := c.tenant
+	c.mu.Unlock()
+	if tenant == nil {
+		var err error
+		if tenant, err = c.lookupTenant(ctx); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := tenant.Connect(ctx)
+	c.mu.Lock()
+	if err != nil {
+		c.tenant = nil
+	} else {
+		c.tenant = tenant
+	}
+	c.mu.Unlock()
+	return conn, err
+}
+
+// lookupTenant returns the connector to the tenant database, with its SQL
+// port looked up on SYSTEMDB, or else the configured port.
+func (c *sessionConnector) lookupTenant(ctx context.Context) (driver.Connector, error) {
+	port, err := c.lookupTenantPort(ctx)
+	if err != nil {
+		if c.databasePort == "" {
+			return nil, err
+		}
+		log.Debugf("Error looking up the SQL port of tenant database %s, using port %s: %s", c.databaseName, c.databasePort, err)
+		port = c.databasePort
+	}
+	return c.tenantConnector(port)
+}
+
+// lookupTenantPort returns the SQL port of the tenant database, looked up
+// on SYSTEMDB.
+func (c *sessionConnector) lookupTenantPort(ctx context.Context) (string, error) {
+	db := sql.OpenDB(c.Connector)
+	defer db.Close()
+	var port int
+	if err := db.QueryRowContext(ctx, tenantPortQuery, c.databaseName).Scan(&port); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("no SQL port of tenant database %s", c.databaseName)
+		}
+		return "", err
+	}
+	return strconv.Itoa(port), nil
+}
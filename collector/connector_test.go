@@ -0,0 +1,332 @@
+package collector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	hdb "github.com/SAP/go-hdb/driver"
+	"github.com/jenningsloy318/hana_exporter/config"
+)
+
+// newTestCertificate returns a self-signed certificate for localhost
+// expiring at notAfter, and its PEM encoding.
+func newTestCertificate(t *testing.T, notAfter time.Time) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestTLSConfigServerCertificate(t *testing.T) {
+	notAfter := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+	cert, certPEM := newTestCertificate(t, notAfter)
+
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stand-in of the target completes the TLS handshakes.
+	listener, err := tls.Listen("tcp", "localhost:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := connectOptions{
+		host: net.JoinHostPort("localhost", port),
+		tls:  config.TLSConfig{Enabled: true, CAFile: caFile},
+	}
+	serverCert := &serverCertificate{}
+	if _, ok := serverCert.expiry(); ok {
+		t.Fatal("expiry is set before any handshake")
+	}
+	tlsConfig, err := o.tlsConfig(serverCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ServerName != "localhost" {
+		t.Errorf("ServerName = %q, want the host of the target", tlsConfig.ServerName)
+	}
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	got, ok := serverCert.expiry()
+	if !ok {
+		t.Fatal("expiry is not set after the handshake")
+	}
+	if !got.Equal(notAfter) {
+		t.Errorf("expiry = %s, want %s", got, notAfter)
+	}
+}
+
+func TestTLSConfigServerName(t *testing.T) {
+	o := connectOptions{
+		host: "10.0.0.1:30015",
+		tls:  config.TLSConfig{Enabled: true, ServerName: "hana.example.com"},
+	}
+	tlsConfig, err := o.tlsConfig(&serverCertificate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ServerName != "hana.example.com" {
+		t.Errorf("ServerName = %q, want the configured server_name", tlsConfig.ServerName)
+	}
+}
+
+func TestSessionConnector(t *testing.T) {
+	portColumns := []string{"SQL_PORT"}
+	tests := []struct {
+		name           string
+		databaseConfig config.DatabaseConfig
+		// systemDB answers the lookup of the tenant port.
+		systemDB fakeResult
+		// wantPort is the port of the tenant connected to, empty if the
+		// target is connected to.
+		wantPort       string
+		wantStatements []string
+		wantErr        bool
+	}{
+		{
+			name:           "defaults",
+			databaseConfig: config.DatabaseConfig{User: "SYSTEM"},
+			wantStatements: []string{"SET 'APPLICATION' = 'hana_exporter'"},
+		},
+		{
+			name: "session variables and schema",
+			databaseConfig: config.DatabaseConfig{
+				User:             "SYSTEM",
+				ApplicationName:  "it's",
+				DefaultSchema:    `MON"X`,
+				SessionVariables: map[string]string{"B": "2", "A": "1"},
+			},
+			wantStatements: []string{
+				"SET 'APPLICATION' = 'it''s'",
+				"SET 'A' = '1'",
+				"SET 'B' = '2'",
+				`SET SCHEMA "MON""X"`,
+			},
+		},
+		{
+			name:           "tenant",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", DatabaseName: "HDB"},
+			systemDB:       fakeResult{columns: portColumns, rows: [][]driver.Value{{int64(30041)}}},
+			wantPort:       "30041",
+			wantStatements: []string{"SET 'APPLICATION' = 'hana_exporter'"},
+		},
+		{
+			name:           "tenant not found",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", DatabaseName: "HDB"},
+			systemDB:       fakeResult{columns: portColumns},
+			wantErr:        true,
+		},
+		{
+			name:           "tenant lookup failed, configured port",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", DatabaseName: "HDB", DatabasePort: 30044},
+			systemDB:       fakeResult{columns: portColumns, err: errors.New("authentication failed")},
+			wantPort:       "30044",
+			wantStatements: []string{"SET 'APPLICATION' = 'hana_exporter'"},
+		},
+		{
+			name:           "tenant lookup preferred to the configured port",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", DatabaseName: "HDB", DatabasePort: 30044},
+			systemDB:       fakeResult{columns: portColumns, rows: [][]driver.Value{{int64(30041)}}},
+			wantPort:       "30041",
+			wantStatements: []string{"SET 'APPLICATION' = 'hana_exporter'"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := newConnectOptions("hana:30013", test.databaseConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			connector, err := o.connector(&serverCertificate{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := connector.(*sessionConnector)
+			target := &fakeConnector{result: test.systemDB}
+			sc.Connector = target
+			tenant := &fakeConnector{}
+			var gotPort string
+			if sc.tenantConnector != nil {
+				sc.tenantConnector = func(port string) (driver.Connector, error) {
+					gotPort = port
+					return tenant, nil
+				}
+			}
+
+			conn, err := sc.Connect(context.Background())
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+			if gotPort != test.wantPort {
+				t.Errorf("connected to tenant port %q, want %q", gotPort, test.wantPort)
+			}
+			got := target.statements
+			if test.wantPort != "" {
+				if len(target.statements) > 0 {
+					t.Errorf("statements %q executed on SYSTEMDB", target.statements)
+				}
+				got = tenant.statements
+			}
+			if !reflect.DeepEqual(got, test.wantStatements) {
+				t.Errorf("got statements %q, want %q", got, test.wantStatements)
+			}
+		})
+	}
+}
+
+func TestSessionConnectorSystemDBUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		databaseConfig config.DatabaseConfig
+		wantUser       string
+	}{
+		{
+			name:           "user of the tenant",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", Password: "a", DatabaseName: "HDB"},
+			wantUser:       "MONITOR",
+		},
+		{
+			name:           "user of SYSTEMDB",
+			databaseConfig: config.DatabaseConfig{User: "MONITOR", Password: "a", DatabaseName: "HDB", SystemDBUser: "SYSTEM", SystemDBPassword: "b"},
+			wantUser:       "SYSTEM",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := newConnectOptions("hana:30013", test.databaseConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			connector, err := o.connector(&serverCertificate{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := connector.(*sessionConnector)
+			if got := sc.Connector.(*hdb.Connector).Username(); got != test.wantUser {
+				t.Errorf("SYSTEMDB is logged on to as %s, want %s", got, test.wantUser)
+			}
+			tenant, err := sc.tenantConnector("30041")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tenant.(*hdb.Connector).Username(); got != "MONITOR" {
+				t.Errorf("the tenant is logged on to as %s, want MONITOR", got)
+			}
+			if got := tenant.(*hdb.Connector).Host(); got != "hana:30041" {
+				t.Errorf("the tenant is connected to at %s, want hana:30041", got)
+			}
+		})
+	}
+}
+
+func TestPoolReopenTLSFiles(t *testing.T) {
+	_, certPEM := newTestCertificate(t, time.Now().Add(time.Hour))
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	databaseConfig := config.DatabaseConfig{User: "SYSTEM", TLS: config.TLSConfig{Enabled: true, CAFile: caFile}}
+
+	p := NewPool(0, 1)
+	first, release, err := p.Get("hana:30015", databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	same, release, err := p.Get("hana:30015", databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if same != first {
+		t.Fatal("the pool is reopened with unchanged TLS files")
+	}
+
+	// The renewed CA file is read by a new pool.
+	renewed := time.Now().Add(time.Minute)
+	if err := os.Chtimes(caFile, renewed, renewed); err != nil {
+		t.Fatal(err)
+	}
+	reopened, release, err := p.Get("hana:30015", databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if reopened == first {
+		t.Error("the pool is not reopened with the renewed CA file")
+	}
+	if got := p.reconnects[poolKey{target: "hana:30015", user: "SYSTEM"}]; got != 1 {
+		t.Errorf("got %v reconnects, want 1", got)
+	}
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateLabel is the label holding the state of a state-set metric.
+const stateLabel = "state"
+
+// enum lists the known values of a status column.
+type enum []string
+
+// newStateSetDesc returns the descriptor of a state-set metric, with the
+// state label appended to labels.
+func newStateSetDesc(subsystem, name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, name),
+		help,
+		append(append([]string{}, labels...), stateLabel), nil,
+	)
+}
+
+// collect sends one series per known state of the column, 1 for the current
+// value and 0 for the others, in the OpenMetrics state-set style. A value
+// which is not a known state is sent as an additional series with value 1,
+// so that it is never dropped silently.
+func (e enum) collect(ch chan<- prometheus.Metric, desc *prometheus.Desc, value string, labelValues ...string) {
+	known := false
+	for _, state := range e {
+		v := 0.0
+		if state == value {
+			v = 1
+			known = true
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, append(labelValues, state)...)
+	}
+	if !known {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, append(labelValues, value)...)
+	}
+}
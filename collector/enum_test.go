@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEnumCollect(t *testing.T) {
+	e := enum{"YES", "NO", "STOPPING"}
+	desc := newStateSetDesc("test", "status", "Test status.", []string{"host"})
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{
+			value: "NO",
+			want: []string{
+				`hana_test_status{host="h1",state="NO"} 1`,
+				`hana_test_status{host="h1",state="STOPPING"} 0`,
+				`hana_test_status{host="h1",state="YES"} 0`,
+			},
+		},
+		{
+			// An unknown state is sent as an additional series.
+			value: "UNKNOWN",
+			want: []string{
+				`hana_test_status{host="h1",state="NO"} 0`,
+				`hana_test_status{host="h1",state="STOPPING"} 0`,
+				`hana_test_status{host="h1",state="UNKNOWN"} 1`,
+				`hana_test_status{host="h1",state="YES"} 0`,
+			},
+		},
+		{
+			value: "",
+			want: []string{
+				`hana_test_status{host="h1",state=""} 1`,
+				`hana_test_status{host="h1",state="NO"} 0`,
+				`hana_test_status{host="h1",state="STOPPING"} 0`,
+				`hana_test_status{host="h1",state="YES"} 0`,
+			},
+		},
+	}
+	for _, test := range tests {
+		ch := make(chan prometheus.Metric, len(e)+1)
+		e.collect(ch, desc, test.value, "h1")
+		close(ch)
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		got := formatMetrics(t, metrics)
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("value %q: got\n%s\nwant\n%s", test.value, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+
+	hdb "github.com/SAP/go-hdb/driver"
+)
+
+// Error classes, used as the class label of the scrape error metrics.
+const (
+	errorClassAuthentication = "authentication_failed"
+	errorClassPrivilege      = "insufficient_privilege"
+	errorClassInvalidObject  = "invalid_object"
+	errorClassTimeout        = "timeout"
+	errorClassConnection     = "connection_lost"
+	errorClassOther          = "other"
+)
+
+// HANA SQL error codes, see the SAP HANA SQL reference.
+const (
+	hdbErrAuthenticationFailed   = 10
+	hdbErrInsufficientPrivilege  = 258
+	hdbErrInvalidTableName       = 259
+	hdbErrInvalidColumnName      = 260
+	hdbErrInvalidSchemaName      = 362
+	hdbErrPasswordChangeRequired = 414
+	hdbErrUserDeactivated        = 416
+	hdbErrUserLocked             = 663
+	hdbErrOperationCancelled     = 139
+)
+
+// classifyError maps an error returned by the database to one of the
+// error classes, so that a missing grant can be told apart from a database
+// which is down. The errors may be wrapped.
+func classifyError(err error) string {
+	chain := unwrapErrors(err)
+	for _, err := range chain {
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			return errorClassTimeout
+		}
+	}
+	for _, err := range chain {
+		hdbErr, ok := err.(hdb.Error)
+		if !ok {
+			continue
+		}
+		switch hdbErr.Code() {
+		case hdbErrAuthenticationFailed, hdbErrPasswordChangeRequired, hdbErrUserDeactivated, hdbErrUserLocked:
+			return errorClassAuthentication
+		case hdbErrInsufficientPrivilege:
+			return errorClassPrivilege
+		case hdbErrInvalidTableName, hdbErrInvalidColumnName, hdbErrInvalidSchemaName:
+			return errorClassInvalidObject
+		case hdbErrOperationCancelled:
+			return errorClassTimeout
+		}
+		return errorClassOther
+	}
+	for _, err := range chain {
+		netErr, ok := err.(net.Error)
+		if !ok {
+			continue
+		}
+		if netErr.Timeout() {
+			return errorClassTimeout
+		}
+		return errorClassConnection
+	}
+	for _, err := range chain {
+		if err == driver.ErrBadConn || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errorClassConnection
+		}
+	}
+	return errorClassOther
+}
+
+// unwrapErrors returns err followed by the errors it wraps through an
+// Unwrap method, as errors.Unwrap does since Go 1.13.
+func unwrapErrors(err error) []error {
+	var chain []error
+	for err != nil {
+		chain = append(chain, err)
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return chain
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	hdb "github.com/SAP/go-hdb/driver"
+)
+
+// hdbError is embedded by fakeHDBError, whose Error method would clash with
+// an embedded hdb.Error.
+type hdbError hdb.Error
+
+// fakeHDBError is a HANA error with the given code. It implements
+// hdb.Error, the other methods are not called.
+type fakeHDBError struct {
+	hdbError
+	code int
+}
+
+func (e fakeHDBError) Error() string {
+	return fmt.Sprintf("SQL Error %d", e.code)
+}
+
+func (e fakeHDBError) Code() int {
+	return e.code
+}
+
+// wrappedError wraps err as the database/sql package and the callers may.
+type wrappedError struct {
+	err error
+}
+
+func (e wrappedError) Error() string {
+	return "wrapped: " + e.err.Error()
+}
+
+func (e wrappedError) Unwrap() error {
+	return e.err
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "deadline", err: context.DeadlineExceeded, want: errorClassTimeout},
+		{name: "cancelled", err: context.Canceled, want: errorClassTimeout},
+		{name: "authentication", err: fakeHDBError{code: hdbErrAuthenticationFailed}, want: errorClassAuthentication},
+		{name: "user locked", err: fakeHDBError{code: hdbErrUserLocked}, want: errorClassAuthentication},
+		{name: "privilege", err: fakeHDBError{code: hdbErrInsufficientPrivilege}, want: errorClassPrivilege},
+		{name: "invalid table", err: fakeHDBError{code: hdbErrInvalidTableName}, want: errorClassInvalidObject},
+		{name: "operation cancelled", err: fakeHDBError{code: hdbErrOperationCancelled}, want: errorClassTimeout},
+		{name: "other HANA error", err: fakeHDBError{code: 1}, want: errorClassOther},
+		{name: "network timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: errorClassTimeout},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: errorClassConnection},
+		{name: "bad connection", err: driver.ErrBadConn, want: errorClassConnection},
+		{name: "EOF", err: io.EOF, want: errorClassConnection},
+		{name: "other", err: errors.New("boom"), want: errorClassOther},
+		{name: "wrapped deadline", err: wrappedError{context.DeadlineExceeded}, want: errorClassTimeout},
+		{name: "wrapped HANA error", err: wrappedError{fakeHDBError{code: hdbErrInsufficientPrivilege}}, want: errorClassPrivilege},
+		{name: "wrapped network error", err: wrappedError{&net.OpError{Op: "read", Err: errors.New("reset")}}, want: errorClassConnection},
+		{name: "wrapped bad connection", err: wrappedError{driver.ErrBadConn}, want: errorClassConnection},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classifyError(test.err); got != test.want {
+				t.Errorf("got class %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// timeoutError is a network error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
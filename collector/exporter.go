@@ -1,14 +1,20 @@
 package collector
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"strconv"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/SAP/go-hdb/driver"
+	"github.com/jenningsloy318/hana_exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 )
@@ -21,18 +27,23 @@ const (
 
 // SQL Queries.
 const (
-	upQuery = `select  SYSTEM_ID AS SID, DATABASE_NAME AS DB_NAME,Version from "SYS"."M_DATABASE";`
+	upQuery      = `select  SYSTEM_ID AS SID, DATABASE_NAME AS DB_NAME,Version from "SYS"."M_DATABASE";`
+	tenantsQuery = `SELECT DATABASE_NAME, ACTIVE_STATUS FROM "SYS"."M_DATABASES";`
 )
 
 // Metric descriptors.
 var (
-	HanaInfoLabelNames  = []string{"sid", "db_name", "db_version"}
-	HanaInfoLabelValues = make([]string, 3, 3)
-	scrapeDurationDesc  = prometheus.NewDesc(
+	HanaInfoLabelNames = []string{"sid", "db_name", "db_version"}
+	scrapeDurationDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, exporter, "collector_duration_seconds"),
 		"Collector time duration.",
 		[]string{"collector"}, nil,
 	)
+	collectorSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "collector_success"),
+		"Whether the collector succeeded in the last scrape (1 for success, 0 for error).",
+		[]string{"collector"}, nil,
+	)
 	hanaUpDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "up"),
 		"Collector time duration.",
@@ -43,209 +54,355 @@ var (
 		"Collector time duration.",
 		HanaInfoLabelNames, nil,
 	)
+	collectorSkippedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "collector_skipped"),
+		"Whether the collector was skipped in the last scrape because it does not support the HANA version of the target.",
+		[]string{"collector", "reason"}, nil,
+	)
+	tenantActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "tenant", "active"),
+		"Whether the tenant database is active (1 for active, 0 for inactive) from SYS.M_DATABASES.",
+		[]string{"database_name"}, nil,
+	)
 )
 
-// Exporter collects HANA metrics. It implements prometheus.Collector.
-type Exporter struct {
-	dsn          string
-	scrapers     []Scraper
-	error        prometheus.Gauge
-	totalScrapes prometheus.Counter
-	scrapeErrors *prometheus.CounterVec
-}
-
-// split string, use @ as delimiter to split the dsn to get hana instance
+// exporterLabelNames and exporterMetricNames are the labels and the names
+// of the metrics of the exporter itself, of its targets and of the
+// connection pool, besides those of the scrapers. They are taken from the
+// descriptors, so that they cannot miss a metric.
+var exporterLabelNames, exporterMetricNames = descNames(func(ch chan<- *prometheus.Desc) {
+	(&cachedExporter{poll: &poll{target: NewTarget("", BreakerConfig{})}}).Describe(ch)
+	(&poolCollector{}).Describe(ch)
+})
 
-//func stringsplit(s rune) bool {
-//	if s == '@' {
-//		return true
-//	}
-//	return false
-//}
+var (
+	// fqNameRE extracts the name of a metric from its descriptor.
+	fqNameRE = regexp.MustCompile(`fqName: "([^"]+)"`)
+	// variableLabelsRE extracts the variable labels from a descriptor.
+	variableLabelsRE = regexp.MustCompile(`variableLabels: \[([^\]]*)\]`)
+)
 
-// New returns a new HANA exporter for the provided DSN.
-func New(host string, user string, password string, scrapers []Scraper) *Exporter {
-	//	BaseLabelValues[0] = host
-	return &Exporter{
-		dsn:      fmt.Sprintf("hdb://%s:%s@%s", user, password, host),
-		scrapers: scrapers,
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: exporter,
-			Name:      "scrapes_total",
-			Help:      "Total number of times HANA was scraped for metrics.",
-		}),
-		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: namespace,
-			Subsystem: exporter,
-			Name:      "scrape_errors_total",
-			Help:      "Total number of times an error occurred scraping a HANA.",
-		}, []string{"collector"}),
-		error: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Subsystem: exporter,
-			Name:      "last_scrape_error",
-			Help:      "Whether the last scrape of metrics from HANA resulted in an error (1 for error, 0 for success).",
-		}),
+// descNames returns the sorted variable labels and metric names of the
+// descriptors sent by describe. The client library has no accessors for
+// them, they are parsed from the descriptions.
+func descNames(describe func(chan<- *prometheus.Desc)) (labels, names []string) {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		describe(ch)
+		close(ch)
+	}()
+	seenLabels, seenNames := make(map[string]bool), make(map[string]bool)
+	for desc := range ch {
+		s := desc.String()
+		if m := fqNameRE.FindStringSubmatch(s); m != nil && !seenNames[m[1]] {
+			seenNames[m[1]] = true
+			names = append(names, m[1])
+		}
+		if m := variableLabelsRE.FindStringSubmatch(s); m != nil {
+			for _, label := range strings.Fields(m[1]) {
+				if !seenLabels[label] {
+					seenLabels[label] = true
+					labels = append(labels, label)
+				}
+			}
+		}
 	}
+	sort.Strings(labels)
+	sort.Strings(names)
+	return labels, names
 }
 
-// Describe implements prometheus.Collector.
-func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	// We cannot know in advance what metrics the exporter will generate
-	// from HANA. So we use the poor man's describe method: Run a collect
-	// and send the descriptors of all the collected metrics. The problem
-	// here is that we need to connect to the HANA DB. If it is currently
-	// unavailable, the descriptors will be incomplete. Since this is a
-	// stand-alone exporter and not used as a library within other code
-	// implementing additional metrics, the worst that can happen is that we
-	// don't detect inconsistent metrics created by this exporter
-	// itself. Also, a change in the monitored HANA instance may change the
-	// exported metrics during the runtime of the exporter.
-
-	metricCh := make(chan prometheus.Metric)
-	doneCh := make(chan struct{})
-
-	go func() {
-		for m := range metricCh {
-			ch <- m.Desc()
+// LabelNames returns the names of the labels of the metrics sent for a
+// target by the exporter and the given scrapers, which the labels of the
+// target must not clash with.
+func LabelNames(scrapers []Scraper) []string {
+	names := append([]string{}, exporterLabelNames...)
+	for _, scraper := range scrapers {
+		if s, ok := scraper.(interface{ LabelNames() []string }); ok {
+			names = append(names, s.LabelNames()...)
 		}
-		close(doneCh)
-	}()
+	}
+	return names
+}
 
-	e.Collect(metricCh)
-	close(metricCh)
-	<-doneCh
+// MetricNames returns the names of the metrics sent for a target by the
+// exporter and the given scrapers, which the metrics of the custom queries
+// must not be named like.
+func MetricNames(scrapers []Scraper) []string {
+	names := append([]string{}, exporterMetricNames...)
+	for _, scraper := range scrapers {
+		if s, ok := scraper.(interface{ MetricNames() []string }); ok {
+			names = append(names, s.MetricNames()...)
+		}
+	}
+	return names
 }
 
-// Collect implements prometheus.Collector.
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+// Exporter collects HANA metrics. It implements prometheus.Collector.
+type Exporter struct {
+	ctx            context.Context
+	pool           *Pool
+	target         *Target
+	databaseConfig config.DatabaseConfig
+	scrapers       []Scraper
+	collectors     map[string]config.CollectorConfig
+}
 
-	e.scrape(ch)
+// New returns a new HANA exporter for the provided target, its connection
+// is taken from the given pool. All queries are cancelled when ctx is done,
+// the settings of each scraper, e.g. its timeout, are taken from collectors.
+func New(ctx context.Context, pool *Pool, target *Target, databaseConfig config.DatabaseConfig, scrapers []Scraper, collectors map[string]config.CollectorConfig) *Exporter {
+	return &Exporter{
+		ctx:            ctx,
+		pool:           pool,
+		target:         target,
+		databaseConfig: databaseConfig,
+		scrapers:       scrapers,
+		collectors:     collectors,
+	}
+}
 
-	ch <- e.totalScrapes
-	ch <- e.error
-	e.scrapeErrors.Collect(ch)
+// Describe implements prometheus.Collector. The descriptors are static, so
+// that no connection to the database is needed to describe the exporter.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	describe(ch, e.target, e.scrapers)
 }
 
-func (e *Exporter) scrape(ch chan<- prometheus.Metric) {
-	e.totalScrapes.Inc()
-	var err error
-	scrapeTime := time.Now()
-	db, err := sql.Open("hdb", e.dsn)
-	if err != nil {
-		log.Errorln("Error opening connection to database:", err)
-		e.error.Set(1)
-		return
+// describe sends the descriptors of the metrics of an exporter running the
+// given scrapers against target.
+func describe(ch chan<- *prometheus.Desc, target *Target, scrapers []Scraper) {
+	ch <- hanaUpDesc
+	ch <- hanaInfoDesc
+	ch <- tenantActiveDesc
+	ch <- scrapeDurationDesc
+	ch <- collectorSuccessDesc
+	ch <- collectorSkippedDesc
+	for _, scraper := range scrapers {
+		scraper.Describe(ch)
 	}
-	defer db.Close()
 
-	// By design exporter should use maximum one connection per request.
-	db.SetMaxOpenConns(1)
-	db.SetMaxIdleConns(1)
-	// Set max lifetime for a connection.
-	db.SetConnMaxLifetime(1 * time.Minute)
+	ch <- targetInfoDesc
+	target.totalScrapes.Describe(ch)
+	target.error.Describe(ch)
+	target.scrapeErrors.Describe(ch)
+	target.sharedScrapes.Describe(ch)
+	target.roleChanges.Describe(ch)
+	ch <- breakerStateDesc
+	ch <- breakerNextRetryDesc
+	ch <- servingHostDesc
+}
 
-	isUpRows, err := db.Query(upQuery)
-	if err != nil {
-		log.Errorln("Error pinging hana:", err)
-		ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 0)
-		e.error.Set(1)
-		return
+// Collect implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	if e.scrape(ch) {
+		e.target.error.Set(0)
 	} else {
-		ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 1)
-		var sid string
-		var db_name string
-		var db_version string
-		for isUpRows.Next() {
-			if err := isUpRows.Scan(&sid, &db_name, &db_version); err != nil {
-				return 
-			}
-		}
-		HanaInfoLabelValues = []string{sid, db_name, db_version}
-
-		ch <- prometheus.MustNewConstMetric(hanaInfoDesc, prometheus.GaugeValue, 1, HanaInfoLabelValues...)
-
+		e.target.error.Set(1)
 	}
-	isUpRows.Close()
+	e.target.collect(ch)
+}
 
-	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), "connection")
+// scrape runs all scrapers against the target and reports whether all of
+// them succeeded.
+func (e *Exporter) scrape(ch chan<- prometheus.Metric) bool {
+	e.target.totalScrapes.Inc()
+	inst, release, ok := e.connect(ch)
+	if !ok {
+		return false
+	}
+	defer release()
 
+	var failed int32
 	wg := &sync.WaitGroup{}
-	defer wg.Wait()
 	for _, scraper := range e.scrapers {
 		wg.Add(1)
 		go func(scraper Scraper) {
 			defer wg.Done()
-			label := "collect." + scraper.Name()
-			scrapeTime := time.Now()
-			if err := scraper.Scrape(db, ch); err != nil {
-				log.Errorln("Error scraping for "+label+":", err)
-				e.scrapeErrors.WithLabelValues(label).Inc()
-				e.error.Set(1)
+			if !e.runScraper(inst, scraper, ch) {
+				atomic.StoreInt32(&failed, 1)
 			}
-			ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), label)
 		}(scraper)
 	}
+	wg.Wait()
+	return atomic.LoadInt32(&failed) == 0
 }
 
-func parseStatus(data sql.RawBytes) (float64, bool) {
+// connect logs on to the target and sends the connection metrics. The
+// returned release function must be called once the caller is done with
+// the Instance.
+func (e *Exporter) connect(ch chan<- prometheus.Metric) (*Instance, func(), bool) {
+	if !e.target.breaker.allow() {
+		log.Debugf("Circuit breaker of target %s is open, not connecting", e.target.Name())
+		ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 0, "connection")
+		return nil, nil, false
+	}
 
-	// sys_m_service_statistics
-	if bytes.Equal(data, []byte("YES")) {
-		return 1, true
+	var db *sql.DB
+	var release func()
+	var err error
+	scrapeTime := time.Now()
+	if len(e.databaseConfig.Hosts) > 0 {
+		db, release, err = e.openPrimary(ch)
+	} else {
+		// Opening the pool fails before any logon, e.g. on an unreadable
+		// pass_file or TLS file.
+		db, release, err = e.pool.Get(e.target.Name(), e.databaseConfig)
+	}
+	if err != nil {
+		class := classifyError(err)
+		log.Errorf("Error connecting to target %s (%s): %s", e.target.Name(), class, err)
+		ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 0, "connection")
+		e.target.scrapeErrors.WithLabelValues("connection", class).Inc()
+		e.target.breaker.failure()
+		return nil, nil, false
 	}
-	if bytes.Equal(data, []byte("NO")) {
-		return 0, true
+
+	var sid string
+	var db_name string
+	var db_version string
+	if err := queryUp(e.ctx, db, &sid, &db_name, &db_version); err != nil {
+		class := classifyError(err)
+		log.Errorf("Error pinging hana (%s): %s", class, err)
+		ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 0, "connection")
+		e.target.scrapeErrors.WithLabelValues("connection", class).Inc()
+		e.target.breaker.failure()
+		release()
+		return nil, nil, false
 	}
-	if bytes.Equal(data, []byte("UNKNOWN")) {
-		return 2, true
+	e.target.breaker.success()
+	ch <- prometheus.MustNewConstMetric(hanaUpDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(hanaInfoDesc, prometheus.GaugeValue, 1, sid, db_name, db_version)
+
+	inst := &Instance{
+		db:           db,
+		databaseName: db_name,
+		tenants:      e.databaseConfig.MultiTenant,
 	}
-	if bytes.Equal(data, []byte("STARTING")) {
-		return 3, true
+	if inst.version, err = parseVersion(db_version); err != nil {
+		log.Warnf("Running all collectors regardless of the version: %s", err)
 	}
-	if bytes.Equal(data, []byte("STOPPING")) {
-		return 4, true
+	if inst.tenants {
+		if err := scrapeTenants(e.ctx, inst, ch); err != nil {
+			class := classifyError(err)
+			log.Errorf("Error discovering tenants (%s): %s", class, err)
+			ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 0, "connection")
+			e.target.scrapeErrors.WithLabelValues("connection", class).Inc()
+			release()
+			return nil, nil, false
+		}
 	}
 
-	// sys_m_service_replication
+	ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 1, "connection")
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), "connection")
+	return inst, release, true
+}
 
-	if bytes.Equal(data, []byte("TRUE")) {
-		return 1, true
+// queryUp runs the upQuery and scans the SID, name and version of the
+// database.
+func queryUp(ctx context.Context, db *sql.DB, sid, dbName, dbVersion *string) error {
+	rows, err := db.QueryContext(ctx, upQuery)
+	if err != nil {
+		return err
 	}
-	if bytes.Equal(data, []byte("FALSE")) {
-		return 0, true
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(sid, dbName, dbVersion); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// runScraper runs a single scraper against the connected instance and sends
+// its metrics, and reports whether it succeeded. Skipped scrapers succeed.
+func (e *Exporter) runScraper(inst *Instance, scraper Scraper, ch chan<- prometheus.Metric) bool {
+	label := "collect." + scraper.Name()
+	if reason := skipReason(scraper, inst.version); reason != "" {
+		log.Debugf("Skipping %s on HANA %s: %s", label, inst.version, reason)
+		ch <- prometheus.MustNewConstMetric(collectorSkippedDesc, prometheus.GaugeValue, 1, label, reason)
+		return true
 	}
-	if bytes.Equal(data, []byte("ACTIVE")) {
-		return 1, true
+	scrapeTime := time.Now()
+	collectorConfig := e.collectors[scraper.Name()]
+	ctx := e.ctx
+	if collectorConfig.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, collectorConfig.Timeout)
+		defer cancel()
 	}
-	if bytes.Equal(data, []byte("ERROR")) {
-		return 0, true
+	scraperInst := *inst
+	scraperInst.params = collectorConfig.Params
+	ok := true
+	if err := scrapeOnConn(ctx, &scraperInst, scraper, ch); err != nil {
+		class := classifyError(err)
+		if ctx.Err() != nil {
+			class = errorClassTimeout
+			err = fmt.Errorf("cancelled after %s: %s", time.Since(scrapeTime), ctx.Err())
+		}
+		log.Errorf("Error scraping for %s (%s): %s", label, class, err)
+		e.target.scrapeErrors.WithLabelValues(label, class).Inc()
+		ok = false
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 0, label)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, 1, label)
 	}
-	if bytes.Equal(data, []byte("INITIALIZING")) {
-		return 3, true
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), label)
+	return ok
+}
+
+// scrapeOnConn runs scraper on a connection of its own. The driver does not
+// cancel the statements on the server, a cancelled statement keeps running
+// and its session busy, so the connection is discarded instead of being
+// returned to the pool when ctx is done.
+func scrapeOnConn(ctx context.Context, inst *Instance, scraper Scraper, ch chan<- prometheus.Metric) error {
+	conn, err := inst.db.Conn(ctx)
+	if err != nil {
+		return err
 	}
-	if bytes.Equal(data, []byte("SYNCING")) {
-		return 4, true
+	inst.conn = conn
+	err = scraper.Scrape(ctx, inst, ch)
+	if ctx.Err() != nil {
+		discard(conn)
+	} else {
+		conn.Close()
 	}
+	return err
+}
 
-	//default transform  to float64
-	value, err := strconv.ParseFloat(string(data), 64)
-	return value, err == nil
+// discard closes the driver connection of conn and removes it from the
+// pool.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(driverConn interface{}) error {
+		if c, ok := driverConn.(io.Closer); ok {
+			c.Close()
+		}
+		return driver.ErrBadConn
+	})
+	conn.Close()
 }
 
-func parseConfigString(data string) (float64, bool) {
-	// log_mode
-	if bytes.Equal([]byte(data), []byte("overwrite")) {
-		return 1, true
+// scrapeTenants reports the tenant databases of the system from SYSTEMDB.
+func scrapeTenants(ctx context.Context, inst *Instance, ch chan<- prometheus.Metric) error {
+	tenantsRows, err := inst.db.QueryContext(ctx, tenantsQuery)
+	if err != nil {
+		return err
 	}
+	defer tenantsRows.Close()
 
-	if bytes.Equal([]byte(data), []byte("normal")) {
-		return 0, true
+	var database_name string
+	var active_status string
+	for tenantsRows.Next() {
+		if err := tenantsRows.Scan(&database_name, &active_status); err != nil {
+			return err
+		}
+		active := 0.0
+		if active_status == "YES" {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(tenantActiveDesc, prometheus.GaugeValue, active, database_name)
 	}
-
-	//default transform from string to float64
-	value, err := strconv.ParseFloat(data, 64)
-	return value, err == nil
-
+	return tenantsRows.Err()
 }
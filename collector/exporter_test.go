@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// builtinScrapers are the built-in collectors.
+var builtinScrapers = []Scraper{
+	ScrapeHostResourceUtilization,
+	ScrapeServiceStatistics,
+	ScrapeLicenseStatus,
+	ScrapeDisks,
+	ScrapeSharedMemory,
+	ScrapeCsTables,
+	ScrapeServiceReplication,
+	ScrapeSystemConfig,
+	ScrapeSystemReplication,
+	ScrapeCsUnloads,
+	ScrapeCsLoads,
+	ScrapeRsTables,
+}
+
+// checkPoolUntouched fails t if a connection pool was opened in p.
+func checkPoolUntouched(t *testing.T, p *Pool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.dbs) > 0 || len(p.reconnects) > 0 {
+		t.Errorf("Describe opened %d connection pools", len(p.reconnects))
+	}
+}
+
+func TestExporterDescribe(t *testing.T) {
+	pool := NewPool(0, 1)
+	target := NewTarget("127.0.0.1:1", BreakerConfig{})
+	databaseConfig := config.DatabaseConfig{User: "SYSTEM", Password: "secret"}
+
+	e := New(context.Background(), pool, target, databaseConfig, builtinScrapers, nil)
+	if err := prometheus.NewPedanticRegistry().Register(e); err != nil {
+		t.Fatalf("registering the exporter: %s", err)
+	}
+	shared := NewScrapeGroup(0).Collector(e)
+	if err := prometheus.NewPedanticRegistry().Register(shared); err != nil {
+		t.Fatalf("registering the shared exporter: %s", err)
+	}
+	checkPoolUntouched(t, pool)
+}
+
+func TestCachedExporterDescribe(t *testing.T) {
+	pool := NewPool(0, 1)
+	pl := &poll{
+		poller:  NewPoller(pool, NewTargetRegistry(BreakerConfig{}, 0), 0),
+		target:  NewTarget("127.0.0.1:1", BreakerConfig{}),
+		results: make(map[string]*pollResult),
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(&cachedExporter{poll: pl, scrapers: builtinScrapers}); err != nil {
+		t.Fatalf("registering the cached exporter: %s", err)
+	}
+	// The pedantic registry checks the metrics against the descriptors.
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("gathering the cached exporter: %s", err)
+	}
+	checkPoolUntouched(t, pool)
+}
+
+func TestQueryUp(t *testing.T) {
+	columns := []string{"SID", "DB_NAME", "VERSION"}
+	tests := []struct {
+		name    string
+		result  fakeResult
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			result: fakeResult{columns: columns, rows: [][]driver.Value{{"HXE", "SYSTEMDB", "2.00.048.00.1591276203"}}},
+			want:   []string{"HXE", "SYSTEMDB", "2.00.048.00.1591276203"},
+		},
+		{
+			name:    "scan",
+			result:  fakeResult{columns: columns[:2], rows: [][]driver.Value{{"HXE", "SYSTEMDB"}}},
+			wantErr: true,
+		},
+		{
+			name:    "rows",
+			result:  fakeResult{columns: columns, err: errors.New("connection reset")},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := sql.OpenDB(&fakeConnector{result: test.result})
+			defer db.Close()
+			var sid, dbName, dbVersion string
+			err := queryUp(context.Background(), db, &sid, &dbName, &dbVersion)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := []string{sid, dbName, dbVersion}; strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// checkReserved fails t if a label of the descriptors sent by describe is
+// not in LabelNames(scrapers).
+func checkReserved(t *testing.T, scrapers []Scraper, describe func(chan<- *prometheus.Desc)) {
+	reserved := make(map[string]bool)
+	for _, name := range LabelNames(scrapers) {
+		reserved[name] = true
+	}
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		m := variableLabelsRE.FindStringSubmatch(desc.String())
+		if m == nil {
+			t.Fatalf("no variable labels in %s", desc)
+		}
+		for _, label := range strings.Fields(m[1]) {
+			if !reserved[label] {
+				t.Errorf("label %s of %s is not reserved", label, fqNameRE.FindStringSubmatch(desc.String())[1])
+			}
+		}
+	}
+}
+
+func TestLabelNames(t *testing.T) {
+	// The labels of the exporter are reserved without any scraper.
+	checkReserved(t, nil, func(ch chan<- *prometheus.Desc) {
+		e := &cachedExporter{poll: &poll{target: NewTarget("127.0.0.1:1", BreakerConfig{})}}
+		e.Describe(ch)
+		(&poolCollector{}).Describe(ch)
+	})
+	for _, scraper := range builtinScrapers {
+		checkReserved(t, []Scraper{scraper}, scraper.Describe)
+	}
+}
+
+// checkMetricNames fails t if a metric described by describe is not in
+// MetricNames(scrapers).
+func checkMetricNames(t *testing.T, scrapers []Scraper, describe func(chan<- *prometheus.Desc)) {
+	names := make(map[string]bool)
+	for _, name := range MetricNames(scrapers) {
+		names[name] = true
+	}
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		name := fqNameRE.FindStringSubmatch(desc.String())[1]
+		if !names[name] {
+			t.Errorf("metric %s is not in MetricNames", name)
+		}
+	}
+}
+
+func TestExporterNames(t *testing.T) {
+	// The names are parsed from the descriptions of the descriptors, which
+	// would leave them out if the client library described them otherwise.
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, label := range []string{"collector", "target", "user"} {
+		if !contains(exporterLabelNames, label) {
+			t.Errorf("label %s is not in %q", label, exporterLabelNames)
+		}
+	}
+	for _, name := range []string{"hana_up", "hana_exporter_collector_last_success_timestamp_seconds", "hana_exporter_pool_open_connections"} {
+		if !contains(exporterMetricNames, name) {
+			t.Errorf("metric %s is not in %q", name, exporterMetricNames)
+		}
+	}
+}
+
+func TestMetricNames(t *testing.T) {
+	checkMetricNames(t, nil, func(ch chan<- *prometheus.Desc) {
+		e := &cachedExporter{poll: &poll{target: NewTarget("127.0.0.1:1", BreakerConfig{})}}
+		e.Describe(ch)
+		(&poolCollector{}).Describe(ch)
+	})
+	for _, scraper := range builtinScrapers {
+		checkMetricNames(t, []Scraper{scraper}, scraper.Describe)
+	}
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// roleQuery returns the master nameserver host of the system and the
+// number of its system replication secondaries. SYS.M_SYSTEM_REPLICATION
+// is only filled on the primary of a system replication.
+const roleQuery = `SELECT (SELECT TOP 1 HOST FROM SYS.M_LANDSCAPE_HOST_CONFIGURATION WHERE NAMESERVER_ACTUAL_ROLE = 'MASTER'), (SELECT COUNT(*) FROM SYS.M_SYSTEM_REPLICATION) FROM DUMMY`
+
+// servingHostDesc reports the candidate of a logical target serving the
+// scrape.
+var servingHostDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "serving_host"),
+	"Candidate host of the logical target which served the scrape, with its master nameserver host, always 1.",
+	[]string{"candidate", "host"}, nil,
+)
+
+// failover selects the candidate host serving a logical target, the
+// current primary. It is concurrency-safe.
+type failover struct {
+	mu sync.Mutex
+	// candidate and host are the serving candidate and its master
+	// nameserver host, empty before the first selection.
+	candidate, host string
+	// replicated is whether the serving candidate is the primary of a
+	// system replication.
+	replicated bool
+}
+
+// candidateRole is the role of a candidate which accepted the logon.
+type candidateRole struct {
+	candidate, host string
+	secondaries     int
+	db              *sql.DB
+	release         func()
+}
+
+// openPrimary returns the connection pool of the primary of the logical
+// target. The candidates are tried from the serving candidate on. A
+// candidate without system replication secondaries is only taken when no
+// other candidate has any, so that a takeover is followed. The serving host
+// is sent to ch.
+func (e *Exporter) openPrimary(ch chan<- prometheus.Metric) (*sql.DB, func(), error) {
+	f := e.target.failover
+	f.mu.Lock()
+	serving, replicated := f.candidate, f.replicated
+	f.mu.Unlock()
+
+	candidates := make([]string, 0, len(e.databaseConfig.Hosts))
+	if serving != "" {
+		candidates = append(candidates, serving)
+	}
+	for _, candidate := range e.databaseConfig.Hosts {
+		if candidate != serving {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	// The candidates are probed without holding f.mu, so that an
+	// unreachable candidate does not hold up the other scrapes of the
+	// target until the timeout of this one.
+	var selected *candidateRole
+	var lastErr error
+	for i, candidate := range candidates {
+		role, err := e.probe(candidate)
+		if err != nil {
+			log.Debugf("Candidate %s of target %s is not available: %s", candidate, e.target.Name(), err)
+			lastErr = err
+			continue
+		}
+		if selected == nil || (selected.secondaries == 0 && role.secondaries > 0) {
+			if selected != nil {
+				selected.release()
+			}
+			selected = role
+		} else {
+			role.release()
+		}
+		// The serving candidate is kept as long as it is the primary,
+		// or no candidate has ever been.
+		if selected.secondaries > 0 || (i == 0 && candidate == serving && !replicated) {
+			break
+		}
+	}
+	if selected == nil {
+		return nil, nil, lastErr
+	}
+
+	f.mu.Lock()
+	if f.candidate != "" && (f.candidate != selected.candidate || f.host != selected.host) {
+		log.Infof("Target %s is now served by %s (%s), was %s (%s)", e.target.Name(), selected.candidate, selected.host, f.candidate, f.host)
+		e.target.roleChanges.Inc()
+	}
+	f.candidate, f.host, f.replicated = selected.candidate, selected.host, selected.secondaries > 0
+	f.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(servingHostDesc, prometheus.GaugeValue, 1, selected.candidate, selected.host)
+	return selected.db, selected.release, nil
+}
+
+// probe logs on to candidate and returns its role.
+func (e *Exporter) probe(candidate string) (*candidateRole, error) {
+	db, release, err := e.pool.Get(candidate, e.databaseConfig)
+	if err != nil {
+		return nil, err
+	}
+	role := &candidateRole{candidate: candidate, db: db, release: release}
+	var host sql.NullString
+	if err := db.QueryRowContext(e.ctx, roleQuery).Scan(&host, &role.secondaries); err != nil {
+		release()
+		return nil, err
+	}
+	role.host = host.String
+	return role, nil
+}
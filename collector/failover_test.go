@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// candidateState is the answer of a candidate host to roleQuery, or the
+// error of its logon.
+type candidateState struct {
+	host        string
+	secondaries int64
+	err         error
+}
+
+// failoverExporter returns an exporter of the logical target with the given
+// candidates, in the given states.
+func failoverExporter(target *Target, candidates []string, states map[string]candidateState) *Exporter {
+	pool := NewPool(0, 1)
+	pool.newConnector = func(o connectOptions, _ *serverCertificate) (driver.Connector, error) {
+		state, ok := states[o.host]
+		if !ok {
+			state.err = errors.New("connection refused")
+		}
+		result := fakeResult{columns: []string{"HOST", "SECONDARIES"}, err: state.err}
+		if state.err == nil {
+			result.rows = [][]driver.Value{{state.host, state.secondaries}}
+		}
+		return &fakeConnector{result: result}, nil
+	}
+	databaseConfig := config.DatabaseConfig{User: "SYSTEM", Password: "secret", Hosts: candidates}
+	return New(context.Background(), pool, target, databaseConfig, nil, nil)
+}
+
+func TestOpenPrimary(t *testing.T) {
+	type step struct {
+		states map[string]candidateState
+		// want is the serving candidate, empty if no candidate is
+		// available.
+		want        string
+		roleChanges int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "candidate with secondaries preferred",
+			steps: []step{{
+				states: map[string]candidateState{
+					"a:30015": {host: "a"},
+					"b:30015": {host: "b", secondaries: 1},
+				},
+				want:        "b:30015",
+				roleChanges: 0,
+			}},
+		},
+		{
+			name: "serving candidate without system replication kept",
+			steps: []step{
+				{
+					states:      map[string]candidateState{"b:30015": {host: "b"}},
+					want:        "b:30015",
+					roleChanges: 0,
+				},
+				{
+					states: map[string]candidateState{
+						"a:30015": {host: "a"},
+						"b:30015": {host: "b"},
+					},
+					want:        "b:30015",
+					roleChanges: 0,
+				},
+			},
+		},
+		{
+			name: "probe errors",
+			steps: []step{
+				{
+					states: map[string]candidateState{
+						"a:30015": {err: errors.New("authentication failed")},
+						"b:30015": {host: "b"},
+					},
+					want:        "b:30015",
+					roleChanges: 0,
+				},
+				{
+					states:      map[string]candidateState{},
+					roleChanges: 0,
+				},
+			},
+		},
+		{
+			name: "takeover",
+			steps: []step{
+				{
+					states: map[string]candidateState{
+						"a:30015": {host: "a", secondaries: 1},
+						"b:30015": {host: "b"},
+					},
+					want:        "a:30015",
+					roleChanges: 0,
+				},
+				{
+					states: map[string]candidateState{
+						"a:30015": {host: "a"},
+						"b:30015": {host: "b", secondaries: 1},
+					},
+					want:        "b:30015",
+					roleChanges: 1,
+				},
+			},
+		},
+		{
+			name: "master nameserver moved",
+			steps: []step{
+				{
+					states:      map[string]candidateState{"a:30015": {host: "a1", secondaries: 1}},
+					want:        "a:30015",
+					roleChanges: 0,
+				},
+				{
+					states:      map[string]candidateState{"a:30015": {host: "a2", secondaries: 1}},
+					want:        "a:30015",
+					roleChanges: 1,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := NewTarget("hana", BreakerConfig{})
+			for i, step := range test.steps {
+				e := failoverExporter(target, []string{"a:30015", "b:30015"}, step.states)
+				ch := make(chan prometheus.Metric, 1)
+				db, release, err := e.openPrimary(ch)
+				if step.want == "" {
+					if err == nil {
+						release()
+						t.Fatalf("step %d: got no error", i)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %d: %s", i, err)
+				}
+				if db == nil {
+					t.Fatalf("step %d: got no connection pool", i)
+				}
+				release()
+
+				want := []string{`hana_exporter_serving_host{candidate="` + step.want + `",host="` + step.states[step.want].host + `"} 1`}
+				if got := formatMetrics(t, []prometheus.Metric{<-ch}); !reflect.DeepEqual(got, want) {
+					t.Errorf("step %d: got serving host %q, want %q", i, got, want)
+				}
+				if got, want := formatMetrics(t, []prometheus.Metric{target.roleChanges})[0], fmt.Sprintf("hana_exporter_role_changes_total %d", step.roleChanges); got != want {
+					t.Errorf("step %d: got role changes %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestOpenPrimaryConcurrent checks that a scrape probing an unreachable
+// candidate does not hold up the other scrapes of the target.
+func TestOpenPrimaryConcurrent(t *testing.T) {
+	target := NewTarget("hana", BreakerConfig{})
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	slow := failoverExporter(target, []string{"a:30015"}, nil)
+	slow.pool.newConnector = func(connectOptions, *serverCertificate) (driver.Connector, error) {
+		// The connection signals entered and fails once unblock is closed.
+		return &fakeConnector{connect: func() error {
+			entered <- struct{}{}
+			<-unblock
+			return errors.New("connection timed out")
+		}}, nil
+	}
+
+	done := make(chan error)
+	go func() {
+		_, _, err := slow.openPrimary(make(chan prometheus.Metric, 1))
+		done <- err
+	}()
+	<-entered
+
+	fast := failoverExporter(target, []string{"a:30015"}, map[string]candidateState{"a:30015": {host: "a", secondaries: 1}})
+	_, release, err := fast.openPrimary(make(chan prometheus.Metric, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	close(unblock)
+	if err := <-done; err == nil {
+		t.Error("got no error from the blocked probe")
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query placeholders, expanded by Instance.Query depending on the mode.
+const (
+	// schemaPlaceholder is replaced by the schema of the monitoring views.
+	schemaPlaceholder = "{{schema}}"
+	// databaseNamePlaceholder is replaced by the DATABASE_NAME column,
+	// followed by a comma, in tenant mode and removed otherwise.
+	databaseNamePlaceholder = "{{database_name}}"
+)
+
+var (
+	singleDatabaseReplacer = strings.NewReplacer(
+		schemaPlaceholder, "SYS",
+		databaseNamePlaceholder, "",
+	)
+	tenantDatabasesReplacer = strings.NewReplacer(
+		schemaPlaceholder, "SYS_DATABASES",
+		databaseNamePlaceholder, "DATABASE_NAME,",
+	)
+)
+
+// Instance is the HANA database a scrape runs against, passed to the
+// Scrapers.
+type Instance struct {
+	db *sql.DB
+	// conn is the connection of the running collector, the queries run on
+	// db when not set.
+	conn *sql.Conn
+	// databaseName is the name of the connected database.
+	databaseName string
+	// tenants is set when connected to SYSTEMDB to scrape all tenant
+	// databases in one pass through the SYS_DATABASES views.
+	tenants bool
+	// version is the version of the connected database, zero if unknown.
+	// Scrapers may use it to choose between alternate queries.
+	version Version
+	// params are the parameters of the running collector.
+	params map[string]string
+}
+
+// Query expands the placeholders of q and runs it on the connection of the
+// running collector.
+func (i *Instance) Query(ctx context.Context, q string, args ...interface{}) (*sql.Rows, error) {
+	if i.tenants {
+		q = tenantDatabasesReplacer.Replace(q)
+	} else {
+		q = singleDatabaseReplacer.Replace(q)
+	}
+	if i.conn != nil {
+		return i.conn.QueryContext(ctx, q, args...)
+	}
+	return i.db.QueryContext(ctx, q, args...)
+}
+
+// IntParam returns the integer parameter of the running collector with the
+// given name, or def when it is not set.
+func (i *Instance) IntParam(name string, def int) (int, error) {
+	v, ok := i.params[name]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid parameter %s: %s", name, err)
+	}
+	return n, nil
+}
+
+// DatabaseName returns the name of the connected database.
+func (i *Instance) DatabaseName() string {
+	return i.databaseName
+}
+
+// Tenants reports whether all tenant databases are scraped through the
+// SYS_DATABASES views of SYSTEMDB, see the {{database_name}} placeholder.
+func (i *Instance) Tenants() bool {
+	return i.tenants
+}
+
+// Version returns the version of the connected database, zero if unknown.
+func (i *Instance) Version() Version {
+	return i.version
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInstanceQuery(t *testing.T) {
+	const query = "SELECT {{database_name}} HOST FROM {{schema}}.M_DISKS WHERE SCHEMA_NAME <> '{{schema}}'"
+	tests := []struct {
+		name    string
+		tenants bool
+		// conn runs the query on a connection of the instance.
+		conn bool
+		want string
+	}{
+		{name: "single database", want: "SELECT  HOST FROM SYS.M_DISKS WHERE SCHEMA_NAME <> 'SYS'"},
+		{name: "tenant databases", tenants: true, want: "SELECT DATABASE_NAME, HOST FROM SYS_DATABASES.M_DISKS WHERE SCHEMA_NAME <> 'SYS_DATABASES'"},
+		{name: "connection", tenants: true, conn: true, want: "SELECT DATABASE_NAME, HOST FROM SYS_DATABASES.M_DISKS WHERE SCHEMA_NAME <> 'SYS_DATABASES'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &fakeConnector{}
+			db := sql.OpenDB(c)
+			defer db.Close()
+			inst := &Instance{db: db, tenants: test.tenants}
+			if test.conn {
+				conn, err := db.Conn(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				inst.conn = conn
+			}
+			rows, err := inst.Query(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows.Close()
+			if len(c.queries) != 1 || c.queries[0] != test.want {
+				t.Errorf("ran %q, want %q", c.queries, test.want)
+			}
+		})
+	}
+}
+
+func TestInstanceTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants bool
+		result  fakeResult
+		want    []string
+	}{
+		{
+			name: "single database",
+			result: fakeResult{
+				columns: []string{"HOST", "PATH", "USAGE_TYPE", "TOTAL_SIZE", "USED_SIZE"},
+				rows:    [][]driver.Value{{"h1", "/data", "DATA", 100.0, 10.0}},
+			},
+			want: []string{
+				`hana_sys_m_disks_total_size{database_name="HDB",host="h1",path="/data",usage_type="DATA"} 100`,
+				`hana_sys_m_disks_used_size{database_name="HDB",host="h1",path="/data",usage_type="DATA"} 10`,
+			},
+		},
+		{
+			name:    "tenant databases",
+			tenants: true,
+			result: fakeResult{
+				columns: []string{"DATABASE_NAME", "HOST", "PATH", "USAGE_TYPE", "TOTAL_SIZE", "USED_SIZE"},
+				rows: [][]driver.Value{
+					{"SYSTEMDB", "h1", "/data", "DATA", 100.0, 10.0},
+					{"T1", "h1", "/data", "DATA", 200.0, 20.0},
+					{"T2", "h1", "/data", "DATA", 300.0, 30.0},
+				},
+			},
+			want: []string{
+				`hana_sys_m_disks_total_size{database_name="SYSTEMDB",host="h1",path="/data",usage_type="DATA"} 100`,
+				`hana_sys_m_disks_total_size{database_name="T1",host="h1",path="/data",usage_type="DATA"} 200`,
+				`hana_sys_m_disks_total_size{database_name="T2",host="h1",path="/data",usage_type="DATA"} 300`,
+				`hana_sys_m_disks_used_size{database_name="SYSTEMDB",host="h1",path="/data",usage_type="DATA"} 10`,
+				`hana_sys_m_disks_used_size{database_name="T1",host="h1",path="/data",usage_type="DATA"} 20`,
+				`hana_sys_m_disks_used_size{database_name="T2",host="h1",path="/data",usage_type="DATA"} 30`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &fakeConnector{result: test.result}
+			db := sql.OpenDB(c)
+			defer db.Close()
+			inst := &Instance{db: db, databaseName: "HDB", tenants: test.tenants}
+			var err error
+			metrics, _ := collectMetrics(func(ch chan<- prometheus.Metric) bool {
+				err = ScrapeDisks.Scrape(context.Background(), inst, ch)
+				return err == nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatMetrics(t, metrics); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got metrics\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestInstanceIntParam(t *testing.T) {
+	inst := &Instance{params: map[string]string{"limit": "10", "bad": "x"}}
+	if n, err := inst.IntParam("limit", 5); n != 10 || err != nil {
+		t.Errorf("IntParam(limit) = %d, %v, want 10", n, err)
+	}
+	if n, err := inst.IntParam("unset", 5); n != 5 || err != nil {
+		t.Errorf("IntParam(unset) = %d, %v, want the default 5", n, err)
+	}
+	if _, err := inst.IntParam("bad", 5); err == nil {
+		t.Error("IntParam(bad) succeeded, want an error")
+	}
+}
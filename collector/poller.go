@@ -0,0 +1,372 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// Metric descriptors.
+var (
+	lastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "collector_last_success_timestamp_seconds"),
+		"Unix time of the last successful run of the collector by the background poller.",
+		[]string{"collector"}, nil,
+	)
+)
+
+// PollTarget is a target polled in the background by a Poller.
+type PollTarget struct {
+	Name           string
+	DatabaseConfig config.DatabaseConfig
+	// Module is the name of the module the Scrapers are taken from.
+	Module   string
+	Scrapers []Scraper
+	// Timeout, if positive, cancels a run after the given duration, as the
+	// timeout of the module cancels a scrape.
+	Timeout time.Duration
+	// Collectors are the collector settings, the interval of a collector
+	// defaults to the interval of the Poller.
+	Collectors map[string]config.CollectorConfig
+}
+
+// Poller scrapes targets in the background, each collector at its own
+// interval, and caches the last metrics of every collector so that scrapes
+// are served from memory without waiting for HANA.
+type Poller struct {
+	pool     *Pool
+	targets  *TargetRegistry
+	interval time.Duration
+
+	mu    sync.Mutex
+	polls map[string]*poll
+}
+
+// NewPoller returns a Poller taking its connections from pool. Collectors
+// without an interval are run every interval.
+func NewPoller(pool *Pool, targets *TargetRegistry, interval time.Duration) *Poller {
+	return &Poller{
+		pool:     pool,
+		targets:  targets,
+		interval: interval,
+		polls:    make(map[string]*poll),
+	}
+}
+
+// Update sets the polled targets. Polling of the targets which are not
+// given anymore is stopped, the cached metrics of the others are kept.
+func (p *Poller) Update(targets []PollTarget) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		seen[t.Name] = true
+		if pl, ok := p.polls[t.Name]; ok {
+			pl.update(t)
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		// The state of a polled target is kept until polling stops.
+		target, release := p.targets.Get(t.Name)
+		pl := &poll{
+			poller: p,
+			target: target,
+			cancel: func() {
+				cancel()
+				release()
+			},
+			wake:    make(chan struct{}, 1),
+			config:  t,
+			results: make(map[string]*pollResult),
+		}
+		p.polls[t.Name] = pl
+		log.Infof("Polling target %s in the background", t.Name)
+		go pl.run(ctx)
+	}
+	for name, pl := range p.polls {
+		if !seen[name] {
+			log.Infof("Stopped polling target %s", name)
+			pl.cancel()
+			delete(p.polls, name)
+		}
+	}
+}
+
+// Collector returns a prometheus.Collector serving the cached metrics of the
+// given scrapers of target with module. ok is false if the target is not
+// polled with that module, or if any of the scrapers is not polled.
+func (p *Poller) Collector(target, module string, scrapers []Scraper) (prometheus.Collector, bool) {
+	p.mu.Lock()
+	pl, ok := p.polls[target]
+	p.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	if pl.config.Module != module {
+		return nil, false
+	}
+	polled := make(map[string]bool, len(pl.config.Scrapers))
+	for _, scraper := range pl.config.Scrapers {
+		polled[scraper.Name()] = true
+	}
+	for _, scraper := range scrapers {
+		if !polled[scraper.Name()] {
+			return nil, false
+		}
+	}
+	return &cachedExporter{poll: pl, scrapers: scrapers}, true
+}
+
+// pollResult is the outcome of the last run of a collector.
+type pollResult struct {
+	metrics     []prometheus.Metric
+	nextRun     time.Time
+	lastSuccess time.Time
+}
+
+// poll polls a single target.
+type poll struct {
+	poller *Poller
+	target *Target
+	cancel context.CancelFunc
+	// wake interrupts the wait for the next run after an update.
+	wake chan struct{}
+
+	mu     sync.RWMutex
+	config PollTarget
+	// connection holds the connection metrics of the last run.
+	connection            []prometheus.Metric
+	connectionLastSuccess time.Time
+	results               map[string]*pollResult
+}
+
+// update replaces the settings of the polled target.
+func (pl *poll) update(t PollTarget) {
+	pl.mu.Lock()
+	pl.config = t
+	pl.mu.Unlock()
+	select {
+	case pl.wake <- struct{}{}:
+	default:
+	}
+}
+
+// interval returns the interval of the given collector, the caller must
+// hold pl.mu.
+func (pl *poll) interval(name string) time.Duration {
+	if interval := pl.config.Collectors[name].Interval; interval > 0 {
+		return interval
+	}
+	return pl.poller.interval
+}
+
+// timeout returns the timeout of a run of the due collectors, the caller
+// must hold pl.mu. A run never outlasts the shortest interval of its
+// collectors, nor the timeout of the target.
+func (pl *poll) timeout(due []Scraper) time.Duration {
+	timeout := pl.poller.interval
+	for _, scraper := range due {
+		if interval := pl.interval(scraper.Name()); interval < timeout {
+			timeout = interval
+		}
+	}
+	if pl.config.Timeout > 0 && pl.config.Timeout < timeout {
+		timeout = pl.config.Timeout
+	}
+	return timeout
+}
+
+// run polls the target until ctx is cancelled. Every run logs on to the
+// target and runs the collectors which are due. It runs at least once per
+// interval of the Poller, so that the connection metrics stay current.
+func (pl *poll) run(ctx context.Context) {
+	for {
+		next := pl.runOnce(ctx)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-pl.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// runOnce runs the collectors which are due and returns the time of the
+// next run.
+func (pl *poll) runOnce(ctx context.Context) time.Time {
+	now := time.Now()
+	pl.mu.RLock()
+	t := pl.config
+	var due []Scraper
+	for _, scraper := range t.Scrapers {
+		if result, ok := pl.results[scraper.Name()]; ok && now.Before(result.nextRun) {
+			continue
+		}
+		due = append(due, scraper)
+	}
+	timeout := pl.timeout(due)
+	pl.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	e := New(ctx, pl.poller.pool, pl.target, t.DatabaseConfig, due, t.Collectors)
+	pl.target.totalScrapes.Inc()
+
+	var inst *Instance
+	var release func()
+	connection, connected := collectMetrics(func(ch chan<- prometheus.Metric) bool {
+		var ok bool
+		inst, release, ok = e.connect(ch)
+		return ok
+	})
+	results := make(map[string]*pollResult, len(due))
+	if connected {
+		var mu sync.Mutex
+		wg := &sync.WaitGroup{}
+		for _, scraper := range due {
+			wg.Add(1)
+			go func(scraper Scraper) {
+				defer wg.Done()
+				metrics, ok := collectMetrics(func(ch chan<- prometheus.Metric) bool {
+					return e.runScraper(inst, scraper, ch)
+				})
+				result := &pollResult{metrics: metrics}
+				if ok {
+					result.lastSuccess = now
+				}
+				mu.Lock()
+				results[scraper.Name()] = result
+				mu.Unlock()
+			}(scraper)
+		}
+		wg.Wait()
+		release()
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	failed := !connected
+	pl.connection = connection
+	if connected {
+		pl.connectionLastSuccess = now
+	}
+	for _, scraper := range due {
+		name := scraper.Name()
+		cached, ok := pl.results[name]
+		if !ok {
+			cached = &pollResult{}
+			pl.results[name] = cached
+		}
+		interval := pl.interval(name)
+		result, ran := results[name]
+		if !ran {
+			// The collector did not run for a connection error, keep its
+			// metrics and retry with the next run.
+			if pl.poller.interval < interval {
+				interval = pl.poller.interval
+			}
+			cached.nextRun = now.Add(interval)
+			continue
+		}
+		cached.metrics = result.metrics
+		cached.nextRun = now.Add(interval)
+		if result.lastSuccess.IsZero() {
+			failed = true
+		} else {
+			cached.lastSuccess = result.lastSuccess
+		}
+	}
+	if failed {
+		pl.target.error.Set(1)
+	} else {
+		pl.target.error.Set(0)
+	}
+
+	// Forget the collectors which are not polled anymore.
+	polled := make(map[string]bool, len(pl.config.Scrapers))
+	for _, scraper := range pl.config.Scrapers {
+		polled[scraper.Name()] = true
+	}
+	next := now.Add(pl.poller.interval)
+	for name, cached := range pl.results {
+		if !polled[name] {
+			delete(pl.results, name)
+		} else if cached.nextRun.Before(next) {
+			next = cached.nextRun
+		}
+	}
+	return next
+}
+
+// collectMetrics runs f and returns the metrics it sent along with its
+// result.
+func collectMetrics(f func(ch chan<- prometheus.Metric) bool) ([]prometheus.Metric, bool) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+	ok := f(ch)
+	close(ch)
+	return <-done, ok
+}
+
+// cachedExporter serves the metrics cached by a poll. It implements
+// prometheus.Collector.
+type cachedExporter struct {
+	poll     *poll
+	scrapers []Scraper
+}
+
+// Describe implements prometheus.Collector.
+func (e *cachedExporter) Describe(ch chan<- *prometheus.Desc) {
+	describe(ch, e.poll.target, e.scrapers)
+	ch <- lastSuccessDesc
+}
+
+// Collect implements prometheus.Collector. Collectors which have not run
+// yet are left out.
+func (e *cachedExporter) Collect(ch chan<- prometheus.Metric) {
+	pl := e.poll
+	pl.mu.RLock()
+	for _, m := range pl.connection {
+		ch <- m
+	}
+	if !pl.connectionLastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, timestamp(pl.connectionLastSuccess), "connection")
+	}
+	for _, scraper := range e.scrapers {
+		cached, ok := pl.results[scraper.Name()]
+		if !ok {
+			continue
+		}
+		for _, m := range cached.metrics {
+			ch <- m
+		}
+		if !cached.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, timestamp(cached.lastSuccess), "collect."+scraper.Name())
+		}
+	}
+	pl.mu.RUnlock()
+
+	pl.target.collect(ch)
+}
+
+// timestamp returns t in seconds since the Unix epoch.
+func timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
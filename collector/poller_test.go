@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+)
+
+func TestPollTimeout(t *testing.T) {
+	collectors := map[string]config.CollectorConfig{
+		ScrapeDisks.Name(): {Interval: 30 * time.Second},
+	}
+	tests := []struct {
+		name    string
+		due     []Scraper
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{name: "poller interval", due: []Scraper{ScrapeLicenseStatus}, want: time.Minute},
+		{name: "collector interval", due: []Scraper{ScrapeLicenseStatus, ScrapeDisks}, want: 30 * time.Second},
+		{name: "module timeout", due: []Scraper{ScrapeDisks}, timeout: 10 * time.Second, want: 10 * time.Second},
+		{name: "module timeout above the intervals", due: []Scraper{ScrapeDisks}, timeout: 50 * time.Second, want: 30 * time.Second},
+		{name: "no collector due", timeout: 10 * time.Second, want: 10 * time.Second},
+	}
+	for _, test := range tests {
+		pl := &poll{
+			poller: &Poller{interval: time.Minute},
+			config: PollTarget{Timeout: test.timeout, Collectors: collectors},
+		}
+		if got := pl.timeout(test.due); got != test.want {
+			t.Errorf("%s: timeout %s, want %s", test.name, got, test.want)
+		}
+	}
+}
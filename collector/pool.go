@@ -0,0 +1,255 @@
+package collector
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// Metric descriptors.
+var (
+	poolLabelNames          = []string{"target", "user"}
+	poolOpenConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "pool_open_connections"),
+		"Number of established connections to the target, both in use and idle.",
+		poolLabelNames, nil,
+	)
+	poolInUseConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "pool_in_use_connections"),
+		"Number of connections to the target currently in use.",
+		poolLabelNames, nil,
+	)
+	poolWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "pool_wait_count_total"),
+		"Total number of connections waited for because the pool of the target was exhausted.",
+		poolLabelNames, nil,
+	)
+	tlsCertificateExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "tls_server_certificate_expiry_days"),
+		"Days until the certificate presented by the target in the last TLS handshake expires.",
+		poolLabelNames, nil,
+	)
+	poolReconnectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "pool_reconnects_total"),
+		"Total number of times the pool of the target was reopened after a change of the credentials or connection options.",
+		poolLabelNames, nil,
+	)
+)
+
+// pooledDB is a long-lived connection pool of a single target and user.
+type pooledDB struct {
+	db       *sql.DB
+	options  connectOptions
+	cert     *serverCertificate
+	refs     int
+	lastUsed time.Time
+	// retired is set once the pool is replaced, it is closed when its last
+	// user releases it. retiredWaits is its wait count at that time.
+	retired      bool
+	retiredWaits int64
+}
+
+// Pool keeps one long-lived *sql.DB per target and user, so that scrapes
+// reuse established HANA sessions instead of logging on every time.
+type Pool struct {
+	mu         sync.Mutex
+	dbs        map[poolKey]*pooledDB
+	reconnects map[poolKey]float64
+	// waitCounts are the wait counts of the replaced pools, so that
+	// hana_exporter_pool_wait_count_total does not restart from 0 with a
+	// new pool.
+	waitCounts   map[poolKey]int64
+	idleTimeout  time.Duration
+	maxOpenConns int
+	// newConnector returns the driver connector of a new pool, it is
+	// replaced by the tests.
+	newConnector func(connectOptions, *serverCertificate) (driver.Connector, error)
+}
+
+// NewPool returns a Pool whose targets are closed after being unused for
+// idleTimeout, with at most maxOpenConns connections per target.
+func NewPool(idleTimeout time.Duration, maxOpenConns int) *Pool {
+	p := &Pool{
+		dbs:          make(map[poolKey]*pooledDB),
+		reconnects:   make(map[poolKey]float64),
+		waitCounts:   make(map[poolKey]int64),
+		idleTimeout:  idleTimeout,
+		maxOpenConns: maxOpenConns,
+		newConnector: connectOptions.connector,
+	}
+	if idleTimeout > 0 {
+		go p.expire()
+	}
+	return p
+}
+
+// poolKey identifies the connection pool of a target and user.
+type poolKey struct {
+	target, user string
+}
+
+// Get returns the connection pool of the given target and user, opening it
+// if needed. The password file of the target, if any, is read again. When
+// the password, the connection options or the TLS files changed since the
+// pool was opened, a new one is opened with the new settings and the old one is closed once
+// released by its users. The returned release function must be called once
+// the caller is done with the *sql.DB.
+func (p *Pool) Get(target string, databaseConfig config.DatabaseConfig) (*sql.DB, func(), error) {
+	options, err := newConnectOptions(target, databaseConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := poolKey{target: target, user: databaseConfig.User}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pdb, ok := p.dbs[key]
+	if ok && pdb.options != options {
+		log.Infof("Credentials, connection options or TLS files of target %s changed, reopening connection pool", target)
+		p.close(key, pdb)
+		ok = false
+	}
+	if !ok {
+		cert := &serverCertificate{}
+		connector, err := p.newConnector(options, cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		db := sql.OpenDB(connector)
+		db.SetMaxOpenConns(p.maxOpenConns)
+		db.SetMaxIdleConns(p.maxOpenConns)
+
+		if _, seen := p.reconnects[key]; seen {
+			p.reconnects[key]++
+		} else {
+			p.reconnects[key] = 0
+		}
+		pdb = &pooledDB{db: db, options: options, cert: cert}
+		p.dbs[key] = pdb
+	}
+	pdb.refs++
+	pdb.lastUsed = time.Now()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			pdb.refs--
+			pdb.lastUsed = time.Now()
+			if pdb.retired && pdb.refs == 0 {
+				// The waits since the pool was replaced.
+				if _, ok := p.reconnects[key]; ok {
+					p.waitCounts[key] += pdb.db.Stats().WaitCount - pdb.retiredWaits
+				}
+				closeDB(key, pdb)
+			}
+			p.mu.Unlock()
+		})
+	}
+	return pdb.db, release, nil
+}
+
+// close removes the pool of the given key, the caller must hold p.mu. A
+// pool still in use is closed by the release of its last user, its wait
+// count is carried over to the next pool of the key.
+func (p *Pool) close(key poolKey, pdb *pooledDB) {
+	delete(p.dbs, key)
+	pdb.retired = true
+	pdb.retiredWaits = pdb.db.Stats().WaitCount
+	p.waitCounts[key] += pdb.retiredWaits
+	if pdb.refs == 0 {
+		closeDB(key, pdb)
+	}
+}
+
+// closeDB closes the *sql.DB of a removed pool in the background, since
+// Close waits for the connections in use.
+func closeDB(key poolKey, pdb *pooledDB) {
+	go func() {
+		if err := pdb.db.Close(); err != nil {
+			log.Errorf("Error closing connection pool of target %s: %s", key.target, err)
+		}
+	}()
+}
+
+// expire periodically closes the pools which have been idle for longer
+// than the idle timeout.
+func (p *Pool) expire() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.mu.Lock()
+		for key, pdb := range p.dbs {
+			if pdb.refs == 0 && time.Since(pdb.lastUsed) > p.idleTimeout {
+				log.Debugf("Closing idle connection pool of target %s", key.target)
+				p.close(key, pdb)
+				delete(p.reconnects, key)
+				delete(p.waitCounts, key)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Collector returns the collector of the pool statistics of the given
+// targets, e.g. the candidate hosts of a logical target.
+func (p *Pool) Collector(targets ...string) prometheus.Collector {
+	return &poolCollector{pool: p, targets: targets}
+}
+
+// poolCollector exposes the pool statistics of some targets. It implements
+// prometheus.Collector.
+type poolCollector struct {
+	pool    *Pool
+	targets []string
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolOpenConnectionsDesc
+	ch <- poolInUseConnectionsDesc
+	ch <- poolWaitCountDesc
+	ch <- poolReconnectsDesc
+	ch <- tlsCertificateExpiryDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p := c.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, reconnects := range p.reconnects {
+		if !contains(c.targets, key.target) {
+			continue
+		}
+		var stats sql.DBStats
+		if pdb, ok := p.dbs[key]; ok {
+			stats = pdb.db.Stats()
+			if notAfter, ok := pdb.cert.expiry(); ok {
+				ch <- prometheus.MustNewConstMetric(tlsCertificateExpiryDesc, prometheus.GaugeValue, time.Until(notAfter).Hours()/24, key.target, key.user)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(poolOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.OpenConnections), key.target, key.user)
+		ch <- prometheus.MustNewConstMetric(poolInUseConnectionsDesc, prometheus.GaugeValue, float64(stats.InUse), key.target, key.user)
+		// The waits of the replaced pools are carried over.
+		waitCount := stats.WaitCount + p.waitCounts[key]
+		ch <- prometheus.MustNewConstMetric(poolWaitCountDesc, prometheus.CounterValue, float64(waitCount), key.target, key.user)
+		ch <- prometheus.MustNewConstMetric(poolReconnectsDesc, prometheus.CounterValue, reconnects, key.target, key.user)
+	}
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
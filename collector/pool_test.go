@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// waitForConn makes a caller of db wait for its only connection.
+func waitForConn(t *testing.T, db *sql.DB) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := db.Stats().WaitCount
+	done := make(chan error)
+	go func() {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+	for db.Stats().WaitCount == before {
+		runtime.Gosched()
+	}
+	conn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// poolWaitCount returns hana_exporter_pool_wait_count_total of target.
+func poolWaitCount(t *testing.T, p *Pool, target string) string {
+	metrics, _ := collectMetrics(func(ch chan<- prometheus.Metric) bool {
+		p.Collector(target).Collect(ch)
+		return true
+	})
+	for _, line := range formatMetrics(t, metrics) {
+		if strings.HasPrefix(line, "hana_exporter_pool_wait_count_total{") {
+			return line[strings.LastIndex(line, " ")+1:]
+		}
+	}
+	return ""
+}
+
+func TestPoolWaitCountReopen(t *testing.T) {
+	p := NewPool(0, 1)
+	p.newConnector = func(connectOptions, *serverCertificate) (driver.Connector, error) {
+		return &fakeConnector{}, nil
+	}
+	databaseConfig := config.DatabaseConfig{User: "SYSTEM", Password: "a"}
+
+	old, releaseOld, err := p.Get("hana:30015", databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForConn(t, old)
+	if got := poolWaitCount(t, p, "hana:30015"); got != "1" {
+		t.Fatalf("got wait count %s, want 1", got)
+	}
+
+	// A changed password reopens the pool, the old one is still in use.
+	databaseConfig.Password = "b"
+	db, release, err := p.Get("hana:30015", databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if db == old {
+		t.Fatal("the pool is not reopened")
+	}
+	if got := poolWaitCount(t, p, "hana:30015"); got != "1" {
+		t.Errorf("got wait count %s after reopening, want 1", got)
+	}
+
+	// The waits on the old pool until its release, and on the new one, add
+	// up.
+	waitForConn(t, old)
+	releaseOld()
+	waitForConn(t, db)
+	if got := poolWaitCount(t, p, "hana:30015"); got != "3" {
+		t.Errorf("got wait count %s, want 3", got)
+	}
+}
@@ -0,0 +1,311 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// databaseNameColumn is the column holding the database of a row in tenant
+// mode, it is exported as the database_name label of every metric.
+const databaseNameColumn = "DATABASE_NAME"
+
+// valueColumn is a column of a QueryScraper exported as a metric.
+type valueColumn struct {
+	// column is the name of the column in the result set.
+	column string
+	// name is the metric name, prefixed by the name of the scraper.
+	name string
+	// unit is appended to the metric name, if set.
+	unit string
+	help string
+	// valueType defaults to prometheus.GaugeValue.
+	valueType prometheus.ValueType
+	// enum exports a status column as a state set, see enum.collect.
+	enum enum
+	// mapping maps the string values of the column to numbers, other values
+	// are parsed as numbers, or else logged and skipped.
+	mapping map[string]float64
+
+	desc *prometheus.Desc
+}
+
+// alternateQuery replaces the query of a QueryScraper on older versions.
+type alternateQuery struct {
+	// before is the first version which is not served by query.
+	before Version
+	query  string
+}
+
+// QueryScraper is a Scraper declared by a query, its label columns and its
+// value columns. The columns are matched by name, NULL labels are exported
+// as empty strings and NULL values are skipped. Every metric gets the
+// database_name label, taken from the DATABASE_NAME column if selected or
+// the connected database otherwise.
+type QueryScraper struct {
+	// name of the scraper, also the subsystem of its metrics.
+	name string
+	help string
+	// query is expanded by Instance.Query, see the query placeholders.
+	query string
+	// alternateQueries are used on older versions, the first match wins.
+	alternateQueries []alternateQuery
+	// params are the integer parameters of the scraper with their default,
+	// substituted for {{<param>}} in the query.
+	params map[string]int
+	// labels are the label columns, the label name is the lower-cased
+	// column name.
+	labels []string
+	values []valueColumn
+	// minVersion and maxVersion are returned by SupportedVersions.
+	minVersion, maxVersion Version
+
+	once sync.Once
+}
+
+// NewQueryScraper returns the Scraper of a custom query of the config file.
+// Each value column is exported as hana_<name>_<column>.
+func NewQueryScraper(name string, c config.QueryConfig) (*QueryScraper, error) {
+	valueType := prometheus.GaugeValue
+	switch c.Type {
+	case "", "gauge":
+	case "counter":
+		valueType = prometheus.CounterValue
+	case "untyped":
+		valueType = prometheus.UntypedValue
+	default:
+		return nil, fmt.Errorf("query %s: invalid type %q", name, c.Type)
+	}
+	help := c.Help
+	if help == "" {
+		help = fmt.Sprintf("Custom query %s.", name)
+	}
+	s := &QueryScraper{
+		name:  name,
+		help:  help,
+		query: c.SQL,
+	}
+	for _, label := range c.Labels {
+		s.labels = append(s.labels, strings.ToUpper(label))
+	}
+	for _, value := range c.Values {
+		s.values = append(s.values, valueColumn{
+			column:    strings.ToUpper(value),
+			name:      strings.ToLower(value),
+			help:      help,
+			valueType: valueType,
+		})
+	}
+	return s, nil
+}
+
+// Name of the Scraper. Should be unique.
+func (s *QueryScraper) Name() string {
+	return s.name
+}
+
+// Help describes the role of the Scraper.
+func (s *QueryScraper) Help() string {
+	return s.help
+}
+
+// SupportedVersions implements VersionedScraper.
+func (s *QueryScraper) SupportedVersions() (min, max Version) {
+	return s.minVersion, s.maxVersion
+}
+
+// LabelNames returns the names of the labels of the metrics of s.
+func (s *QueryScraper) LabelNames() []string {
+	names := []string{"database_name"}
+	for _, label := range s.labels {
+		names = append(names, strings.ToLower(label))
+	}
+	for _, v := range s.values {
+		if v.enum != nil {
+			return append(names, stateLabel)
+		}
+	}
+	return names
+}
+
+// MetricNames returns the names of the metrics of s.
+func (s *QueryScraper) MetricNames() []string {
+	names := make([]string, 0, len(s.values))
+	for _, v := range s.values {
+		names = append(names, prometheus.BuildFQName(namespace, s.name, v.metricName()))
+	}
+	return names
+}
+
+// metricName returns the name of the metric of v within its scraper, with
+// the unit appended.
+func (v valueColumn) metricName() string {
+	if v.unit != "" {
+		return v.name + "_" + v.unit
+	}
+	return v.name
+}
+
+// init builds the metric descriptors of the value columns.
+func (s *QueryScraper) init() {
+	s.once.Do(func() {
+		labelNames := []string{"database_name"}
+		for _, label := range s.labels {
+			labelNames = append(labelNames, strings.ToLower(label))
+		}
+		for i := range s.values {
+			v := &s.values[i]
+			name := v.metricName()
+			if v.enum != nil {
+				v.desc = newStateSetDesc(s.name, name, v.help, labelNames)
+				continue
+			}
+			if v.valueType == 0 {
+				v.valueType = prometheus.GaugeValue
+			}
+			v.desc = prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, s.name, name),
+				v.help, labelNames, nil)
+		}
+	})
+}
+
+// Describe sends the descriptors of the metrics of the Scraper.
+func (s *QueryScraper) Describe(ch chan<- *prometheus.Desc) {
+	s.init()
+	for _, v := range s.values {
+		ch <- v.desc
+	}
+}
+
+// Scrape collects data from database connection and sends it over channel as prometheus metric.
+func (s *QueryScraper) Scrape(ctx context.Context, inst *Instance, ch chan<- prometheus.Metric) error {
+	s.init()
+	query := s.query
+	if !inst.version.IsZero() {
+		for _, alternate := range s.alternateQueries {
+			if inst.version.Less(alternate.before) {
+				query = alternate.query
+				break
+			}
+		}
+	}
+	for param, def := range s.params {
+		n, err := inst.IntParam(param, def)
+		if err != nil {
+			return err
+		}
+		query = strings.Replace(query, "{{"+param+"}}", strconv.Itoa(n), -1)
+	}
+
+	rows, err := inst.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[strings.ToUpper(column)] = i
+	}
+
+	// Scan every column, the ones which are not exported into RawBytes.
+	dest := make([]interface{}, len(columns))
+	for i := range dest {
+		dest[i] = new(sql.RawBytes)
+	}
+	var databaseName *sql.NullString
+	if i, found := index[databaseNameColumn]; found {
+		databaseName = new(sql.NullString)
+		dest[i] = databaseName
+	}
+	labels := make([]*sql.NullString, len(s.labels))
+	for j, label := range s.labels {
+		i, found := index[label]
+		if !found {
+			return fmt.Errorf("label column %s not in result of %s", label, s.name)
+		}
+		labels[j] = new(sql.NullString)
+		dest[i] = labels[j]
+	}
+	strValues := make([]*sql.NullString, len(s.values))
+	floatValues := make([]*sql.NullFloat64, len(s.values))
+	for j, v := range s.values {
+		i, found := index[v.column]
+		if !found {
+			return fmt.Errorf("value column %s not in result of %s", v.column, s.name)
+		}
+		if v.enum != nil || v.mapping != nil {
+			strValues[j] = new(sql.NullString)
+			dest[i] = strValues[j]
+		} else {
+			floatValues[j] = new(sql.NullFloat64)
+			dest[i] = floatValues[j]
+		}
+	}
+
+	// seen holds the label values of the rows, a row repeating them would
+	// make the registry reject the whole scrape.
+	seen := make(map[string]bool)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		labelValues := make([]string, 0, len(labels)+1)
+		if databaseName != nil {
+			labelValues = append(labelValues, databaseName.String)
+		} else {
+			labelValues = append(labelValues, inst.databaseName)
+		}
+		for _, label := range labels {
+			labelValues = append(labelValues, label.String)
+		}
+		key := strings.Join(labelValues, "\x00")
+		if seen[key] {
+			return fmt.Errorf("%s returned several rows with the labels %q", s.name, labelValues)
+		}
+		seen[key] = true
+
+		for j, v := range s.values {
+			if v.enum != nil {
+				if strValues[j].Valid {
+					v.enum.collect(ch, v.desc, strValues[j].String, labelValues...)
+				}
+				continue
+			}
+			var value float64
+			if v.mapping != nil {
+				if !strValues[j].Valid {
+					continue
+				}
+				var mapped bool
+				if value, mapped = v.mapping[strValues[j].String]; !mapped {
+					parsed, err := strconv.ParseFloat(strValues[j].String, 64)
+					if err != nil {
+						log.Warnf("Value %q of column %s of %s is neither mapped nor a number, skipped", strValues[j].String, v.column, s.name)
+						continue
+					}
+					value = parsed
+				}
+			} else {
+				if !floatValues[j].Valid {
+					continue
+				}
+				value = floatValues[j].Float64
+			}
+			ch <- prometheus.MustNewConstMetric(v.desc, v.valueType, value, labelValues...)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,333 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeResult is the result of every query run on a fakeConnector.
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	// err is returned once the rows are read.
+	err error
+}
+
+// fakeConnector opens connections answering every query with its result.
+// It implements driver.Connector.
+type fakeConnector struct {
+	result fakeResult
+	// connect, if set, is called before a connection is opened, its error
+	// fails the connection.
+	connect func() error
+
+	mu sync.Mutex
+	// queries and statements are the queries run and the statements
+	// executed on the connections.
+	queries, statements []string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	if c.connect != nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+// fakeConn implements driver.Conn, driver.QueryerContext and
+// driver.ExecerContext.
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.connector.mu.Lock()
+	c.connector.queries = append(c.connector.queries, query)
+	c.connector.mu.Unlock()
+	return &fakeRows{result: c.connector.result}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.connector.mu.Lock()
+	c.connector.statements = append(c.connector.statements, query)
+	c.connector.mu.Unlock()
+	return driver.RowsAffected(0), nil
+}
+
+// fakeRows implements driver.Rows.
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.result.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.rows) {
+		if r.result.err != nil {
+			return r.result.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.next])
+	r.next++
+	return nil
+}
+
+// scrape runs s against a database returning result, and returns the
+// metrics it sent.
+func scrape(s Scraper, result fakeResult) ([]prometheus.Metric, error) {
+	db := sql.OpenDB(&fakeConnector{result: result})
+	defer db.Close()
+	inst := &Instance{db: db, databaseName: "HDB"}
+	var err error
+	metrics, _ := collectMetrics(func(ch chan<- prometheus.Metric) bool {
+		err = s.Scrape(context.Background(), inst, ch)
+		return err == nil
+	})
+	return metrics, err
+}
+
+func TestQueryScraperDuplicateLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   config.QueryConfig
+		result  fakeResult
+		metrics int
+		wantErr bool
+	}{
+		{
+			name:  "no labels, one row",
+			query: config.QueryConfig{SQL: "SELECT", Values: []string{"value"}},
+			result: fakeResult{
+				columns: []string{"VALUE"},
+				rows:    [][]driver.Value{{1.0}},
+			},
+			metrics: 1,
+		},
+		{
+			name:  "no labels, several rows",
+			query: config.QueryConfig{SQL: "SELECT", Values: []string{"value"}},
+			result: fakeResult{
+				columns: []string{"VALUE"},
+				rows:    [][]driver.Value{{1.0}, {2.0}},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "distinct labels",
+			query: config.QueryConfig{SQL: "SELECT", Labels: []string{"host"}, Values: []string{"value"}},
+			result: fakeResult{
+				columns: []string{"HOST", "VALUE"},
+				rows:    [][]driver.Value{{"a", 1.0}, {"b", 2.0}},
+			},
+			metrics: 2,
+		},
+		{
+			name:  "repeated labels",
+			query: config.QueryConfig{SQL: "SELECT", Labels: []string{"host"}, Values: []string{"value"}},
+			result: fakeResult{
+				columns: []string{"HOST", "VALUE"},
+				rows:    [][]driver.Value{{"a", 1.0}, {"a", 2.0}},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "distinct databases",
+			query: config.QueryConfig{SQL: "SELECT", Values: []string{"value"}},
+			result: fakeResult{
+				columns: []string{"DATABASE_NAME", "VALUE"},
+				rows:    [][]driver.Value{{"T1", 1.0}, {"T2", 2.0}},
+			},
+			metrics: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewQueryScraper("test", test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics, err := scrape(s, test.result)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(metrics) != test.metrics {
+				t.Errorf("got %d metrics, want %d", len(metrics), test.metrics)
+			}
+		})
+	}
+}
+
+func TestQueryScraperColumns(t *testing.T) {
+	s := &QueryScraper{
+		name:   "test",
+		labels: []string{"HOST", "PORT"},
+		values: []valueColumn{
+			{column: "USED", name: "used", unit: "bytes", help: "Used."},
+			{column: "COUNT", name: "count", help: "Count.", valueType: prometheus.CounterValue},
+			{column: "ACTIVE", name: "active", help: "Active.", enum: enum{"YES", "NO"}},
+			{column: "MODE", name: "mode", help: "Mode.", mapping: map[string]float64{"PRIMARY": 1, "SECONDARY": 2}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		result  fakeResult
+		want    []string
+		wantErr bool
+	}{
+		{
+			// The columns are matched by name, case-insensitively and in
+			// any order, other columns are ignored.
+			name: "columns by name",
+			result: fakeResult{
+				columns: []string{"mode", "Active", "OTHER", "count", "used", "port", "host"},
+				rows: [][]driver.Value{
+					{"SECONDARY", "YES", []byte("x"), 3.0, 10.0, "30003", "h1"},
+				},
+			},
+			want: []string{
+				`hana_test_active{database_name="HDB",host="h1",port="30003",state="NO"} 0`,
+				`hana_test_active{database_name="HDB",host="h1",port="30003",state="YES"} 1`,
+				`hana_test_count{database_name="HDB",host="h1",port="30003"} 3`,
+				`hana_test_mode{database_name="HDB",host="h1",port="30003"} 2`,
+				`hana_test_used_bytes{database_name="HDB",host="h1",port="30003"} 10`,
+			},
+		},
+		{
+			// NULL labels are empty, NULL values are skipped, unmapped
+			// numbers are parsed and other strings are skipped.
+			name: "NULL",
+			result: fakeResult{
+				columns: []string{"HOST", "PORT", "USED", "COUNT", "ACTIVE", "MODE", "DATABASE_NAME"},
+				rows: [][]driver.Value{
+					{nil, "30003", nil, 1.0, nil, "7", "T1"},
+					{"h2", nil, 5.0, nil, "NO", "unknown", "T2"},
+				},
+			},
+			want: []string{
+				`hana_test_active{database_name="T2",host="h2",port="",state="NO"} 1`,
+				`hana_test_active{database_name="T2",host="h2",port="",state="YES"} 0`,
+				`hana_test_count{database_name="T1",host="",port="30003"} 1`,
+				`hana_test_mode{database_name="T1",host="",port="30003"} 7`,
+				`hana_test_used_bytes{database_name="T2",host="h2",port=""} 5`,
+			},
+		},
+		{
+			name: "missing label column",
+			result: fakeResult{
+				columns: []string{"HOST", "USED", "COUNT", "ACTIVE", "MODE"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing value column",
+			result: fakeResult{
+				columns: []string{"HOST", "PORT", "USED", "ACTIVE", "MODE"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics, err := scrape(s, test.result)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatMetrics(t, metrics)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestScrapeSystemConfigLogMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		logMode string
+		want    []string
+	}{
+		{
+			name:    "known",
+			logMode: "normal",
+			want: []string{
+				`hana_system_config_log_mode{database_name="HDB",state="legacy"} 0`,
+				`hana_system_config_log_mode{database_name="HDB",state="normal"} 1`,
+				`hana_system_config_log_mode{database_name="HDB",state="overwrite"} 0`,
+			},
+		},
+		{
+			// An unknown log_mode is not dropped, it is its own state.
+			name:    "unknown",
+			logMode: "archive",
+			want: []string{
+				`hana_system_config_log_mode{database_name="HDB",state="archive"} 1`,
+				`hana_system_config_log_mode{database_name="HDB",state="legacy"} 0`,
+				`hana_system_config_log_mode{database_name="HDB",state="normal"} 0`,
+				`hana_system_config_log_mode{database_name="HDB",state="overwrite"} 0`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics, err := scrape(ScrapeSystemConfig, fakeResult{
+				columns: []string{"LOG_MODE"},
+				rows:    [][]driver.Value{{test.logMode}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatMetrics(t, metrics)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
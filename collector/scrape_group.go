@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Modes of a shared scrape, used as the mode label of
+// hana_exporter_shared_scrapes_total.
+const (
+	sharedModeInFlight = "in_flight"
+	sharedModeReused   = "reused"
+)
+
+// defaultSharedScrapeTimeout limits a shared execution whose scrape has no
+// deadline, i.e. neither a Prometheus scrape timeout nor a module timeout,
+// since it is not cancelled with the request.
+const defaultSharedScrapeTimeout = 2 * time.Minute
+
+// ScrapeGroup coalesces the scrapes of the same target and collectors, e.g.
+// by a pair of Prometheus servers, so that concurrent scrapes share a single
+// execution against HANA. The result of an execution is also reused by the
+// scrapes starting within the reuse window after it finished.
+type ScrapeGroup struct {
+	reuseWindow time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*scrapeCall
+	// waiting is called before waiting for an in-flight execution, it is
+	// set by the tests.
+	waiting func()
+}
+
+// NewScrapeGroup returns a ScrapeGroup reusing results for reuseWindow, 0
+// shares in-flight executions only.
+func NewScrapeGroup(reuseWindow time.Duration) *ScrapeGroup {
+	return &ScrapeGroup{
+		reuseWindow: reuseWindow,
+		calls:       make(map[string]*scrapeCall),
+	}
+}
+
+// scrapeCall is an execution of a scrape shared by a ScrapeGroup.
+type scrapeCall struct {
+	// done is closed once metrics and ok are set.
+	done    chan struct{}
+	metrics []prometheus.Metric
+	ok      bool
+}
+
+// Collector returns a prometheus.Collector running the scrape of e, or
+// sharing the execution of a concurrent or recent scrape of the same target
+// and collectors.
+func (g *ScrapeGroup) Collector(e *Exporter) prometheus.Collector {
+	return &sharedExporter{group: g, exporter: e}
+}
+
+// do runs scrape unless an execution with the same key is running or has
+// finished within the reuse window, whose result is returned then along
+// with the mode of the sharing. mode is empty if scrape was run.
+func (g *ScrapeGroup) do(key string, scrape func() ([]prometheus.Metric, bool)) (call *scrapeCall, mode string) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		mode = sharedModeReused
+		select {
+		case <-call.done:
+		default:
+			mode = sharedModeInFlight
+			if g.waiting != nil {
+				g.waiting()
+			}
+			<-call.done
+		}
+		return call, mode
+	}
+	call = &scrapeCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.metrics, call.ok = scrape()
+	close(call.done)
+
+	forget := func() {
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+	}
+	if g.reuseWindow > 0 {
+		time.AfterFunc(g.reuseWindow, forget)
+	} else {
+		forget()
+	}
+	return call, ""
+}
+
+// sharedScrape runs the scrape of e for a ScrapeGroup. The execution
+// outlives a cancelled request, since it may serve others.
+func (e *Exporter) sharedScrape() ([]prometheus.Metric, bool) {
+	deadline, ok := e.ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultSharedScrapeTimeout)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	leader := *e
+	leader.ctx = ctx
+	return collectMetrics(leader.scrape)
+}
+
+// key identifies the scrapes which can share an execution: the same target,
+// credentials and mode, running the same collectors with the same settings.
+// The keys outlive the scrapes, so that the database config, passwords
+// included, is only kept as a hash.
+func (e *Exporter) key() string {
+	names := make([]string, 0, len(e.scrapers))
+	for _, scraper := range e.scrapers {
+		collectorConfig := e.collectors[scraper.Name()]
+		names = append(names, fmt.Sprintf("%s%v%v", scraper.Name(), collectorConfig.Timeout, collectorConfig.Params))
+	}
+	sort.Strings(names)
+	databaseConfig := sha256.Sum256([]byte(fmt.Sprintf("%v", e.databaseConfig)))
+	return fmt.Sprintf("%s\x00%s\x00%x\x00%s", e.target.Name(), e.databaseConfig.User, databaseConfig, strings.Join(names, "\x00"))
+}
+
+// sharedExporter runs the scrape of an Exporter through a ScrapeGroup. It
+// implements prometheus.Collector.
+type sharedExporter struct {
+	group    *ScrapeGroup
+	exporter *Exporter
+}
+
+// Describe implements prometheus.Collector.
+func (s *sharedExporter) Describe(ch chan<- *prometheus.Desc) {
+	s.exporter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *sharedExporter) Collect(ch chan<- prometheus.Metric) {
+	target := s.exporter.target
+	call, mode := s.group.do(s.exporter.key(), s.exporter.sharedScrape)
+	if mode != "" {
+		target.sharedScrapes.WithLabelValues(mode).Inc()
+	} else if call.ok {
+		target.error.Set(0)
+	} else {
+		target.error.Set(1)
+	}
+	for _, m := range call.metrics {
+		ch <- m
+	}
+	target.collect(ch)
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeGroupSharing(t *testing.T) {
+	tests := []struct {
+		name        string
+		reuseWindow time.Duration
+		// concurrent scrapes start while the first one runs, later ones
+		// after it finished.
+		concurrent, later int
+		runs              int32
+		inFlight, reused  int
+	}{
+		{name: "single", runs: 1},
+		{name: "in flight", concurrent: 2, runs: 1, inFlight: 2},
+		{name: "no reuse window", concurrent: 1, later: 2, runs: 3, inFlight: 1},
+		{name: "reused", concurrent: 1, later: 2, reuseWindow: time.Minute, runs: 1, inFlight: 1, reused: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewScrapeGroup(test.reuseWindow)
+			waiting := make(chan struct{})
+			g.waiting = func() { waiting <- struct{}{} }
+			var runs int32
+			started := make(chan struct{}, 1)
+			finish := make(chan struct{})
+			scrape := func() ([]prometheus.Metric, bool) {
+				if atomic.AddInt32(&runs, 1) == 1 {
+					started <- struct{}{}
+					<-finish
+				}
+				return nil, true
+			}
+
+			var mu sync.Mutex
+			modes := make(map[string]int)
+			do := func() {
+				_, mode := g.do("key", scrape)
+				mu.Lock()
+				modes[mode]++
+				mu.Unlock()
+			}
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				do()
+			}()
+			<-started
+			for i := 0; i < test.concurrent; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					do()
+				}()
+			}
+			// The running scrape finishes once the concurrent ones wait
+			// for it.
+			for i := 0; i < test.concurrent; i++ {
+				<-waiting
+			}
+			close(finish)
+			wg.Wait()
+			for i := 0; i < test.later; i++ {
+				do()
+			}
+
+			if got := atomic.LoadInt32(&runs); got != test.runs {
+				t.Errorf("ran %d scrapes, want %d", got, test.runs)
+			}
+			if modes[sharedModeInFlight] != test.inFlight {
+				t.Errorf("%d in_flight scrapes, want %d", modes[sharedModeInFlight], test.inFlight)
+			}
+			if modes[sharedModeReused] != test.reused {
+				t.Errorf("%d reused scrapes, want %d", modes[sharedModeReused], test.reused)
+			}
+		})
+	}
+}
+
+func TestScrapeGroupKeys(t *testing.T) {
+	g := NewScrapeGroup(time.Minute)
+	var runs int32
+	scrape := func() ([]prometheus.Metric, bool) {
+		atomic.AddInt32(&runs, 1)
+		return nil, true
+	}
+	g.do("a", scrape)
+	g.do("b", scrape)
+	if _, mode := g.do("a", scrape); mode != sharedModeReused {
+		t.Errorf("mode %q, want %q", mode, sharedModeReused)
+	}
+	if runs != 2 {
+		t.Errorf("ran %d scrapes, want one per key", runs)
+	}
+}
+
+func TestExporterKey(t *testing.T) {
+	target := NewTarget("127.0.0.1:1", BreakerConfig{})
+	key := func(databaseConfig config.DatabaseConfig) string {
+		return New(context.Background(), nil, target, databaseConfig, nil, nil).key()
+	}
+	k := key(config.DatabaseConfig{User: "SYSTEM", Password: "secret"})
+	if strings.Contains(k, "secret") {
+		t.Errorf("key %q holds the password", k)
+	}
+	if k != key(config.DatabaseConfig{User: "SYSTEM", Password: "secret"}) {
+		t.Error("the same config has another key")
+	}
+	if k == key(config.DatabaseConfig{User: "SYSTEM", Password: "other"}) {
+		t.Error("another password has the same key")
+	}
+	if k == key(config.DatabaseConfig{User: "SYSTEM", Password: "secret", Module: "m"}) {
+		t.Error("another module has the same key")
+	}
+}
@@ -1,7 +1,7 @@
 package collector
 
 import (
-	"database/sql"
+	"context"
 
 	_ "github.com/SAP/go-hdb/driver"
 
@@ -15,6 +15,20 @@ type Scraper interface {
 	// Help describes the role of the Scraper.
 	// Example: "Collect from SHOW ENGINE INNODB STATUS"
 	Help() string
+	// Describe sends the descriptors of all the metrics the Scraper may
+	// send, without connecting to the database.
+	Describe(ch chan<- *prometheus.Desc)
 	// Scrape collects data from database connection and sends it over channel as prometheus metric.
-	Scrape(db *sql.DB, ch chan<- prometheus.Metric) error
+	// The queries must be run with ctx through inst.Query, so that they are cancelled when the
+	// scrape times out.
+	Scrape(ctx context.Context, inst *Instance, ch chan<- prometheus.Metric) error
+}
+
+// VersionedScraper is implemented by scrapers which only support a range of
+// HANA versions, they are skipped on other versions.
+type VersionedScraper interface {
+	Scraper
+	// SupportedVersions returns the oldest supported version and the first
+	// unsupported newer version, a zero Version leaves the range open.
+	SupportedVersions() (min, max Version)
 }
@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// targetInfoDesc carries the labels of the target in the config file, which
+// are added to it as to every other metric of the target.
+var targetInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "target", "info"),
+	"Labels of the target in the config file, always 1.",
+	nil, nil,
+)
+
+// Target holds the state of a scraped target which lives across scrapes,
+// so that its counters accumulate over all the scrapes of the target.
+type Target struct {
+	name         string
+	error        prometheus.Gauge
+	totalScrapes prometheus.Counter
+	scrapeErrors *prometheus.CounterVec
+	// sharedScrapes counts the scrapes served from the execution of another
+	// scrape, see ScrapeGroup.
+	sharedScrapes *prometheus.CounterVec
+	breaker       *breaker
+	// failover selects the serving host of a logical target, and
+	// roleChanges counts the changes of the serving host.
+	failover    *failover
+	roleChanges prometheus.Counter
+}
+
+// NewTarget returns the state of a target which has not been scraped yet,
+// guarded by a circuit breaker with the given settings.
+func NewTarget(name string, breakerConfig BreakerConfig) *Target {
+	return &Target{
+		name:     name,
+		breaker:  &breaker{config: breakerConfig},
+		failover: &failover{},
+		roleChanges: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "role_changes_total",
+			Help:      "Total number of times the logical target was served by another candidate host or master nameserver host.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "scrapes_total",
+			Help:      "Total number of times HANA was scraped for metrics.",
+		}),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "scrape_errors_total",
+			Help:      "Total number of times an error occurred scraping a HANA, by collector and error class.",
+		}, []string{"collector", "class"}),
+		sharedScrapes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "shared_scrapes_total",
+			Help:      "Total number of scrapes served from the execution of a concurrent scrape (in_flight) or a recent one (reused).",
+		}, []string{"mode"}),
+		error: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "last_scrape_error",
+			Help:      "Whether the last scrape of metrics from HANA resulted in an error (1 for error, 0 for success).",
+		}),
+	}
+}
+
+// Name returns the target, as given in the target parameter of a scrape.
+func (t *Target) Name() string {
+	return t.name
+}
+
+// collect sends the metrics of the target.
+func (t *Target) collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(targetInfoDesc, prometheus.GaugeValue, 1)
+	ch <- t.totalScrapes
+	ch <- t.error
+	t.scrapeErrors.Collect(ch)
+	t.sharedScrapes.Collect(ch)
+	ch <- t.roleChanges
+	t.breaker.collect(ch)
+}
+
+// TargetRegistry keeps the state of every scraped target. It is
+// concurrency-safe.
+type TargetRegistry struct {
+	mu            sync.Mutex
+	targets       map[string]*registeredTarget
+	breakerConfig BreakerConfig
+	idleTimeout   time.Duration
+}
+
+// registeredTarget is a Target with its usage.
+type registeredTarget struct {
+	target   *Target
+	refs     int
+	lastUsed time.Time
+}
+
+// NewTargetRegistry returns an empty TargetRegistry, whose targets are
+// guarded by circuit breakers with the given settings and forgotten after
+// being unused for idleTimeout.
+func NewTargetRegistry(breakerConfig BreakerConfig, idleTimeout time.Duration) *TargetRegistry {
+	r := &TargetRegistry{
+		targets:       make(map[string]*registeredTarget),
+		breakerConfig: breakerConfig,
+		idleTimeout:   idleTimeout,
+	}
+	if idleTimeout > 0 {
+		go r.expire()
+	}
+	return r
+}
+
+// Get returns the state of the given target, creating it on the first
+// scrape of the target. The returned release function must be called once
+// the caller is done with the target.
+func (r *TargetRegistry) Get(name string) (*Target, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.targets[name]
+	if !ok {
+		rt = &registeredTarget{target: NewTarget(name, r.breakerConfig)}
+		r.targets[name] = rt
+	}
+	rt.refs++
+	rt.lastUsed = time.Now()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			rt.refs--
+			rt.lastUsed = time.Now()
+			r.mu.Unlock()
+		})
+	}
+	return rt.target, release
+}
+
+// expire periodically forgets the targets which have been unused for
+// longer than the idle timeout, e.g. scraped once with a mistyped target.
+func (r *TargetRegistry) expire() {
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.mu.Lock()
+		for name, rt := range r.targets {
+			if rt.refs == 0 && time.Since(rt.lastUsed) > r.idleTimeout {
+				log.Debugf("Forgetting idle target %s", name)
+				delete(r.targets, name)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of a HANA database, as reported in the VERSION
+// column of SYS.M_DATABASE, e.g. 2.00.048.00.1591276203 is major 2, minor 0,
+// revision 48 and patch 0. HANA Cloud reports major version 4.
+type Version struct {
+	Major    int
+	Minor    int
+	Revision int
+	Patch    int
+}
+
+// Known HANA versions.
+var (
+	// hana1SPS10 is the first revision of HANA 1.0 SPS10.
+	hana1SPS10 = Version{Major: 1, Revision: 100}
+	// hana1SPS11 is the first revision of HANA 1.0 SPS11.
+	hana1SPS11 = Version{Major: 1, Revision: 110}
+	// hanaCloud is the first version of HANA Cloud.
+	hanaCloud = Version{Major: 4}
+)
+
+// parseVersion parses the VERSION column of SYS.M_DATABASE.
+func parseVersion(s string) (Version, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 3 {
+		return Version{}, fmt.Errorf("invalid HANA version %q", s)
+	}
+	var numbers [4]int
+	for i := 0; i < len(numbers) && i < len(parts); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid HANA version %q", s)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Revision: numbers[2], Patch: numbers[3]}, nil
+}
+
+// IsZero reports whether v is the zero Version, i.e. unknown.
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Less reports whether v is older than o.
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	if v.Revision != o.Revision {
+		return v.Revision < o.Revision
+	}
+	return v.Patch < o.Patch
+}
+
+// String returns v in the format of the VERSION column, without build id.
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%02d.%03d.%02d", v.Major, v.Minor, v.Revision, v.Patch)
+}
+
+// Reasons for skipping a collector, used as the reason label of
+// hana_exporter_collector_skipped.
+const (
+	skipReasonVersionTooOld = "version_too_old"
+	skipReasonVersionTooNew = "version_too_new"
+)
+
+// skipReason returns why scraper does not support version v, or "" when it
+// does. Scrapers run when the version is unknown.
+func skipReason(scraper Scraper, v Version) string {
+	versioned, ok := scraper.(VersionedScraper)
+	if !ok || v.IsZero() {
+		return ""
+	}
+	min, max := versioned.SupportedVersions()
+	if !min.IsZero() && v.Less(min) {
+		return skipReasonVersionTooOld
+	}
+	if !max.IsZero() && !v.Less(max) {
+		return skipReasonVersionTooNew
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "2.00.048.00.1591276203", want: Version{Major: 2, Revision: 48}},
+		{in: "1.00.122.27.1568902538", want: Version{Major: 1, Revision: 122, Patch: 27}},
+		{in: "4.00.000.00.1608802262", want: Version{Major: 4}},
+		{in: "2.00.059", want: Version{Major: 2, Revision: 59}},
+		{in: "", wantErr: true},
+		{in: "2.00", wantErr: true},
+		{in: "2.x.048.00", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseVersion(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseVersion(%q): expected an error, got %s", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseVersion(%q): %s", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseVersion(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		v, o Version
+		want bool
+	}{
+		{Version{Major: 1, Revision: 122}, Version{Major: 2}, true},
+		{Version{Major: 2}, Version{Major: 1, Revision: 122}, false},
+		{Version{Major: 2, Revision: 48}, Version{Major: 2, Revision: 48, Patch: 1}, true},
+		{Version{Major: 2, Minor: 1}, Version{Major: 2, Revision: 99}, false},
+		{Version{Major: 2, Revision: 48}, Version{Major: 2, Revision: 48}, false},
+	}
+	for _, test := range tests {
+		if got := test.v.Less(test.o); got != test.want {
+			t.Errorf("%s.Less(%s) = %t, want %t", test.v, test.o, got, test.want)
+		}
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	hana1Only := &QueryScraper{name: "hana1", maxVersion: Version{Major: 2}}
+	sps11On := &QueryScraper{name: "sps11", minVersion: hana1SPS11}
+	onPremise := &QueryScraper{name: "on_premise", minVersion: hana1SPS10, maxVersion: hanaCloud}
+	unversioned := &QueryScraper{name: "any"}
+
+	tests := []struct {
+		scraper Scraper
+		version Version
+		want    string
+	}{
+		{hana1Only, Version{Major: 1, Revision: 122}, ""},
+		{hana1Only, Version{Major: 2, Revision: 48}, skipReasonVersionTooNew},
+		{sps11On, Version{Major: 1, Revision: 102}, skipReasonVersionTooOld},
+		{sps11On, Version{Major: 1, Revision: 110}, ""},
+		{onPremise, Version{Major: 1, Revision: 97}, skipReasonVersionTooOld},
+		{onPremise, Version{Major: 2, Revision: 48}, ""},
+		{onPremise, Version{Major: 4}, skipReasonVersionTooNew},
+		{unversioned, Version{Major: 4}, ""},
+		// Scrapers run when the version is unknown.
+		{hana1Only, Version{}, ""},
+		{sps11On, Version{}, ""},
+	}
+	for _, test := range tests {
+		if got := skipReason(test.scraper, test.version); got != test.want {
+			t.Errorf("skipReason(%s, %s) = %q, want %q", test.scraper.Name(), test.version, got, test.want)
+		}
+	}
+}
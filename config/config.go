@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/common/log"
 	yaml "gopkg.in/yaml.v2"
@@ -11,7 +14,16 @@ import (
 
 // Config is the Go representation of the yaml config file.
 type Config struct {
-	Databases map[string]DatabaseConfig `yaml:"databases"`
+	Databases  map[string]DatabaseConfig  `yaml:"databases"`
+	Collectors map[string]CollectorConfig `yaml:"collectors"`
+	Modules    map[string]ModuleConfig    `yaml:"modules"`
+	Queries    map[string]QueryConfig     `yaml:"queries"`
+
+	// targetKeys are the keys of Databases in their order of precedence.
+	targetKeys []targetKey
+	// content is the content of the config file, for the line numbers of
+	// the errors.
+	content []byte
 }
 
 // SafeConfig wraps Config for concurrency-safe operations.
@@ -23,24 +35,231 @@ type SafeConfig struct {
 // Credentials is the Go representation of the credentials section in the yaml
 // config file.
 type DatabaseConfig struct {
+	// User and Password may reference environment variables as ${NAME}.
 	User     string `yaml:"user"`
 	Password string `yaml:"pass"`
+	// PasswordFile is read for the password at every reload and connection
+	// attempt instead of pass.
+	PasswordFile string `yaml:"pass_file"`
+	// PasswordCommand is a credential helper run at every reload instead of
+	// pass, its standard output is the password.
+	PasswordCommand []string `yaml:"exec"`
+	// MultiTenant scrapes all tenant databases through the SYS_DATABASES
+	// views, the target must be the SQL port of SYSTEMDB.
+	MultiTenant bool `yaml:"multi_tenant"`
+	// Module is the scrape module used when no module parameter is given.
+	Module string `yaml:"module"`
+
+	// DialTimeout limits establishing the TCP connection to the target.
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// ReadTimeout limits every read and write on a connection, rounded up
+	// to seconds. The driver default applies when not set.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// FetchSize is the number of rows fetched per round trip.
+	FetchSize int    `yaml:"fetch_size"`
+	Locale    string `yaml:"locale"`
+	// ApplicationName is set as the APPLICATION of the sessions, as shown
+	// in M_SESSION_CONTEXT, hana_exporter when not set.
+	ApplicationName string `yaml:"application_name"`
+	// DefaultSchema is set as the current schema of the sessions.
+	DefaultSchema string `yaml:"default_schema"`
+	// SessionVariables are set on every new session, e.g. to tag the
+	// sessions of the exporter in M_SESSION_CONTEXT.
+	SessionVariables map[string]string `yaml:"session_variables"`
+	// DatabaseName is the tenant database to connect to, its SQL port is
+	// looked up in SYS_DATABASES.M_SERVICES through the target, which must
+	// be the SQL port of SYSTEMDB.
+	DatabaseName string `yaml:"database_name"`
+	// DatabasePort is the SQL port of the tenant database, used when its
+	// lookup fails, e.g. since the user of the tenant cannot log on to
+	// SYSTEMDB.
+	DatabasePort int `yaml:"database_port"`
+	// SystemDBUser and SystemDBPassword look up the SQL port of the tenant
+	// on SYSTEMDB instead of the user of the tenant, they may reference
+	// environment variables as ${NAME}.
+	SystemDBUser     string `yaml:"systemdb_user"`
+	SystemDBPassword string `yaml:"systemdb_pass"`
+	// TLS encrypts the connections to the target.
+	TLS TLSConfig `yaml:"tls"`
+	// Hosts are the candidate hosts of a logical target, the key of the
+	// database is then a name. The scrapes connect to the current primary.
+	Hosts []string `yaml:"hosts"`
+	// Labels are added to every metric of the target, e.g. env or sap_system.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// TLSConfig is the Go representation of the TLS settings of a database in
+// the yaml config file.
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ServerName is the name verified against the server certificate, the
+	// host of the target when not set.
+	ServerName string `yaml:"server_name"`
+	// CAFile is the CA bundle verifying the server certificate, the system
+	// roots when not set.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key, if any.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// InsecureSkipVerify disables the verification of the server
+	// certificate, e.g. in labs with self-signed certificates.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// CollectorConfig is the Go representation of the settings of a single
+// collector in the collectors section of the yaml config file.
+type CollectorConfig struct {
+	// Timeout cancels the queries of the collector after the given duration.
+	Timeout time.Duration `yaml:"timeout"`
+	// Params are collector specific parameters, e.g. the number of tables
+	// reported by sys_m_cs_tables.
+	Params map[string]string `yaml:"params"`
+	// Interval is the polling interval of the collector when polling in
+	// the background, the --poll.interval flag applies when not set.
+	Interval time.Duration `yaml:"interval"`
 }
 
-func (sc *SafeConfig) ReloadConfig(configFile string) error {
+// ModuleConfig is the Go representation of a named scrape module in the
+// modules section of the yaml config file.
+type ModuleConfig struct {
+	// Collectors lists the collectors run by the module, the collectors
+	// enabled by flag are run when empty.
+	Collectors []string `yaml:"collectors"`
+	// Timeout cancels the whole scrape after the given duration.
+	Timeout time.Duration `yaml:"timeout"`
+	// CollectorConfigs overrides the collectors section for this module.
+	CollectorConfigs map[string]CollectorConfig `yaml:"collector_config"`
+}
+
+// QueryConfig is the Go representation of a custom query in the queries
+// section of the yaml config file. The query is run as a collector named after
+// its key in the section.
+type QueryConfig struct {
+	// SQL is the query, it may use the {{schema}} and {{database_name}}
+	// placeholders like the built-in collectors.
+	SQL  string `yaml:"sql"`
+	Help string `yaml:"help"`
+	// Labels are the columns exported as labels.
+	Labels []string `yaml:"labels"`
+	// Values are the columns exported as metrics, named
+	// hana_<query>_<column>.
+	Values []string `yaml:"values"`
+	// Type is the metric type of the values, gauge (default), counter or
+	// untyped.
+	Type string `yaml:"type"`
+	// Timeout cancels the query after the given duration, unless overridden
+	// in the collectors section.
+	Timeout time.Duration `yaml:"timeout"`
+	// Targets restricts the query to the given targets, it runs for all
+	// targets when empty.
+	Targets []string `yaml:"targets"`
+	// Modules restricts the query to the given modules, it runs for all
+	// modules when empty. Modules listing their collectors run the query
+	// only if listed.
+	Modules []string `yaml:"modules"`
+}
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validate checks the query of the given name.
+func (q QueryConfig) validate(name string) error {
+	if !nameRE.MatchString(name) {
+		return fmt.Errorf("invalid query name %q", name)
+	}
+	if strings.TrimSpace(q.SQL) == "" {
+		return fmt.Errorf("query %s: sql is empty", name)
+	}
+	if len(q.Values) == 0 {
+		return fmt.Errorf("query %s: no value columns", name)
+	}
+	switch q.Type {
+	case "", "gauge", "counter", "untyped":
+	default:
+		return fmt.Errorf("query %s: invalid type %q", name, q.Type)
+	}
+	if q.Timeout < 0 {
+		return fmt.Errorf("query %s: negative timeout", name)
+	}
+	seen := map[string]bool{"DATABASE_NAME": true}
+	for _, column := range append(append([]string{}, q.Labels...), q.Values...) {
+		if !nameRE.MatchString(column) {
+			return fmt.Errorf("query %s: invalid column name %q", name, column)
+		}
+		if seen[strings.ToUpper(column)] {
+			return fmt.Errorf("query %s: duplicate or reserved column %s", name, column)
+		}
+		seen[strings.ToUpper(column)] = true
+	}
+	return nil
+}
+
+// AppliesTo reports whether the query runs for the given target and module.
+func (q QueryConfig) AppliesTo(target, module string) bool {
+	return matches(q.Targets, target) && matches(q.Modules, module)
+}
+
+// matches reports whether s is in list, or list is empty.
+func matches(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFile parses and validates the config file, without resolving the
+// passwords. Unknown keys are rejected, they are most likely typos. The
+// checks, if any, run after the validation even if it fails, so that all
+// the errors of the file are reported at once.
+func LoadFile(configFile string, checks ...func(*Config) error) (*Config, error) {
 	var c = &Config{}
 
 	yamlFile, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		log.Errorf("Error reading config file: %s", err)
-		return err
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(yamlFile, c); err != nil {
+		return nil, err
+	}
+	c.content = yamlFile
+	errs := []error{c.validate(yamlFile)}
+	for _, check := range checks {
+		errs = append(errs, check(c))
 	}
+	if err := JoinErrors(errs...); err != nil {
+		return nil, err
+	}
+	if err := c.parseTargetKeys(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	if err := yaml.Unmarshal(yamlFile, c); err != nil {
+// ReloadConfig loads the config file and resolves the passwords. The
+// config is only replaced when check, if any, accepts it.
+func (sc *SafeConfig) ReloadConfig(configFile string, check func(*Config) error) error {
+	var checks []func(*Config) error
+	if check != nil {
+		checks = append(checks, check)
+	}
+	c, err := LoadFile(configFile, checks...)
+	if err != nil {
 		log.Errorf("Error parsing config file: %s", err)
 		return err
 	}
 
+	for name, databaseConfig := range c.Databases {
+		if err := databaseConfig.resolve(name); err != nil {
+			log.Errorf("Error resolving credentials: %s", err)
+			return err
+		}
+		c.Databases[name] = databaseConfig
+	}
+
 	sc.Lock()
 	sc.C = c
 	sc.Unlock()
@@ -49,22 +268,54 @@ func (sc *SafeConfig) ReloadConfig(configFile string) error {
 	return nil
 }
 
-// CredentialsForTarget returns the Credentials for a given target, or the
-// default. It is concurrency-safe.
+// DatabaseConfigForTarget returns the settings of the first key of the
+// databases section matching target, see MatchTarget. It is
+// concurrency-safe.
 func (sc *SafeConfig) DatabaseConfigForTarget(target string) (DatabaseConfig, error) {
-	sc.Lock()
-	defer sc.Unlock()
-	if databaseConfig, ok := sc.C.Databases[target]; ok {
-		return DatabaseConfig{
-			User:     databaseConfig.User,
-			Password: databaseConfig.Password,
-		}, nil
-	}
-	if databaseConfig, ok := sc.C.Databases["default"]; ok {
-		return DatabaseConfig{
-			User:     databaseConfig.User,
-			Password: databaseConfig.Password,
-		}, nil
+	sc.RLock()
+	defer sc.RUnlock()
+	for _, match := range sc.C.MatchTarget(target) {
+		if match.Matched {
+			return sc.C.Databases[match.Key], nil
+		}
 	}
 	return DatabaseConfig{}, fmt.Errorf("no credentials found for target %s", target)
 }
+
+// MatchTarget evaluates the keys of the databases section for target, see
+// Config.MatchTarget. It is concurrency-safe.
+func (sc *SafeConfig) MatchTarget(target string) []TargetMatch {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C.MatchTarget(target)
+}
+
+// ModuleConfig returns the scrape module of the given name, with its
+// collector settings merged over the collectors section. An empty name
+// returns the collectors section alone. It is concurrency-safe.
+func (sc *SafeConfig) ModuleConfig(name string) (ModuleConfig, error) {
+	sc.RLock()
+	defer sc.RUnlock()
+	var module ModuleConfig
+	if name != "" {
+		var ok bool
+		if module, ok = sc.C.Modules[name]; !ok {
+			return ModuleConfig{}, fmt.Errorf("unknown module %s", name)
+		}
+	}
+	collectorConfigs := make(map[string]CollectorConfig, len(sc.C.Collectors)+len(module.CollectorConfigs))
+	for collector, collectorConfig := range sc.C.Collectors {
+		collectorConfigs[collector] = collectorConfig
+	}
+	for collector, collectorConfig := range module.CollectorConfigs {
+		collectorConfigs[collector] = collectorConfig
+	}
+	for name, query := range sc.C.Queries {
+		if collectorConfig := collectorConfigs[name]; collectorConfig.Timeout == 0 && query.Timeout > 0 {
+			collectorConfig.Timeout = query.Timeout
+			collectorConfigs[name] = collectorConfig
+		}
+	}
+	module.CollectorConfigs = collectorConfigs
+	return module, nil
+}
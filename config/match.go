@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of the keys of the databases section, in their order of precedence.
+const (
+	// MatchExact is a single host:port target.
+	MatchExact = "exact"
+	// MatchCIDR is a network and port, e.g. 10.20.0.0/16:30015. The port
+	// may be a glob.
+	MatchCIDR = "cidr"
+	// MatchGlob is a glob over the host:port target, e.g. 10.20.*:3*15.
+	MatchGlob = "glob"
+	// MatchRegex is a regular expression over the whole host:port target,
+	// prefixed with ~.
+	MatchRegex = "regex"
+	// MatchDefault is the default key, matching any target.
+	MatchDefault = "default"
+)
+
+// matchOrder ranks the kinds of keys by precedence.
+var matchOrder = map[string]int{MatchExact: 0, MatchCIDR: 1, MatchGlob: 2, MatchRegex: 3, MatchDefault: 4}
+
+// targetKey is a parsed key of the databases section.
+type targetKey struct {
+	key  string
+	kind string
+	// specificity orders the keys of the same kind, the prefix length of
+	// a network or the number of literal characters of a glob.
+	specificity int
+	network     *net.IPNet
+	port        string
+	re          *regexp.Regexp
+}
+
+// parseTargetKey returns the parsed key of the databases section.
+func parseTargetKey(key string) (targetKey, error) {
+	k := targetKey{key: key}
+	if key == "default" {
+		k.kind = MatchDefault
+		return k, nil
+	}
+	if strings.HasPrefix(key, "~") {
+		re, err := regexp.Compile("^(?:" + key[1:] + ")$")
+		if err != nil {
+			return k, fmt.Errorf("invalid regular expression: %s", err)
+		}
+		k.kind, k.re = MatchRegex, re
+		return k, nil
+	}
+
+	host, port, err := net.SplitHostPort(key)
+	if err == nil && strings.Contains(host, "/") {
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return k, err
+		}
+		if _, err := path.Match(port, ""); err != nil {
+			return k, fmt.Errorf("invalid port pattern %q", port)
+		}
+		k.kind, k.network, k.port = MatchCIDR, network, port
+		k.specificity, _ = network.Mask.Size()
+		return k, nil
+	}
+	if err != nil || strings.ContainsAny(host+port, "*?[") {
+		if !strings.ContainsAny(key, "*?[") {
+			return k, err
+		}
+		if _, err := path.Match(key, ""); err != nil {
+			return k, fmt.Errorf("invalid glob %q", key)
+		}
+		k.kind = MatchGlob
+		k.specificity = len(key) - strings.Count(key, "*") - strings.Count(key, "?")
+		return k, nil
+	}
+
+	if err := checkHostPort(host, port); err != nil {
+		return k, err
+	}
+	k.kind = MatchExact
+	return k, nil
+}
+
+// checkHostPort checks the host and port of a target.
+func checkHostPort(host, port string) error {
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// normalizeTarget returns target with its host in lower case, as host names
+// are case-insensitive. Other targets, e.g. the names of logical targets, are
+// returned unchanged.
+func normalizeTarget(target string) string {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// parseDatabaseKey returns the parsed key of a database. A database with
+// candidate hosts is a logical target whose key is a name, matched exactly.
+func parseDatabaseKey(key string, databaseConfig DatabaseConfig) (targetKey, error) {
+	if len(databaseConfig.Hosts) == 0 {
+		return parseTargetKey(key)
+	}
+	if k, err := parseTargetKey(key); err == nil && k.kind != MatchExact {
+		return k, fmt.Errorf("a %s key cannot have hosts", k.kind)
+	}
+	return targetKey{key: key, kind: MatchExact}, nil
+}
+
+// matches reports whether the key matches target.
+func (k targetKey) matches(target string) bool {
+	switch k.kind {
+	case MatchExact:
+		return normalizeTarget(k.key) == normalizeTarget(target)
+	case MatchCIDR:
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return false
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !k.network.Contains(ip) {
+			return false
+		}
+		ok, _ := path.Match(k.port, port)
+		return ok
+	case MatchGlob:
+		ok, _ := path.Match(k.key, target)
+		return ok
+	case MatchRegex:
+		return k.re.MatchString(target)
+	}
+	return k.kind == MatchDefault
+}
+
+// sortTargetKeys sorts keys by precedence: the exact targets, the networks
+// from the longest prefix, the globs from the most literal characters, the
+// regular expressions and the default. Ties are sorted by key.
+func sortTargetKeys(keys []targetKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.kind != b.kind {
+			return matchOrder[a.kind] < matchOrder[b.kind]
+		}
+		if a.specificity != b.specificity {
+			return a.specificity > b.specificity
+		}
+		return a.key < b.key
+	})
+}
+
+// parseTargetKeys sets the parsed keys of the databases section, in their
+// order of precedence.
+func (c *Config) parseTargetKeys() error {
+	c.targetKeys = make([]targetKey, 0, len(c.Databases))
+	for key, databaseConfig := range c.Databases {
+		k, err := parseDatabaseKey(key, databaseConfig)
+		if err != nil {
+			return fmt.Errorf("database %s: %s", key, err)
+		}
+		c.targetKeys = append(c.targetKeys, k)
+	}
+	sortTargetKeys(c.targetKeys)
+	return nil
+}
+
+// IsTarget reports whether key of the databases section, with the given
+// settings, is a single target, rather than a pattern or the default.
+func IsTarget(key string, databaseConfig DatabaseConfig) bool {
+	k, err := parseDatabaseKey(key, databaseConfig)
+	return err == nil && k.kind == MatchExact
+}
+
+// TargetMatch is a key of the databases section evaluated for a target.
+type TargetMatch struct {
+	Key     string
+	Kind    string
+	Matched bool
+}
+
+// MatchTarget evaluates the keys of the databases section for target, in
+// their order of precedence. The first matching key holds the settings of
+// the target.
+func (c *Config) MatchTarget(target string) []TargetMatch {
+	matches := make([]TargetMatch, 0, len(c.targetKeys))
+	for _, k := range c.targetKeys {
+		matches = append(matches, TargetMatch{Key: k.key, Kind: k.kind, Matched: k.matches(target)})
+	}
+	return matches
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"testing"
+)
+
+// selectedKey returns the key of the databases section holding the
+// settings of target, empty if none matches.
+func selectedKey(c *Config, target string) string {
+	for _, match := range c.MatchTarget(target) {
+		if match.Matched {
+			return match.Key
+		}
+	}
+	return ""
+}
+
+func TestMatchTargetPrecedence(t *testing.T) {
+	c := &Config{Databases: map[string]DatabaseConfig{
+		"10.20.1.5:30015":    {User: "exact"},
+		"10.20.0.0/16:30015": {User: "cidr16"},
+		"10.20.1.0/24:3*15":  {User: "cidr24"},
+		"10.20.*:30015":      {User: "glob"},
+		"10.*:30015":         {User: "shortglob"},
+		"host?:30015":        {User: "glob"},
+		"~db-[a-z]+:30015":   {User: "regex"},
+		"~db-.*:30015":       {User: "regex"},
+		"default":            {User: "default"},
+	}}
+	if err := c.parseTargetKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		// The exact key wins over every pattern.
+		{"10.20.1.5:30015", "10.20.1.5:30015"},
+		// The network with the longest prefix wins, with a port glob.
+		{"10.20.1.6:30015", "10.20.1.0/24:3*15"},
+		{"10.20.1.6:30115", "10.20.1.0/24:3*15"},
+		{"10.20.2.6:30015", "10.20.0.0/16:30015"},
+		// A port outside the glob of a network does not match it.
+		{"10.20.2.6:30041", "default"},
+		// The glob with the most literal characters wins.
+		{"10.30.1.1:30015", "10.*:30015"},
+		{"hostA:30015", "host?:30015"},
+		// Regular expressions are anchored, ties are taken by key.
+		{"db-prod:30015", "~db-.*:30015"},
+		{"xdb-prod:30015", "default"},
+		{"db-prod:300150", "default"},
+		{"unknown:30015", "default"},
+	}
+	for _, test := range tests {
+		if got := selectedKey(c, test.target); got != test.want {
+			t.Errorf("target %s uses %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestMatchTargetHostCase(t *testing.T) {
+	c := &Config{Databases: map[string]DatabaseConfig{
+		"HANA1.example.com:30015": {},
+		"[::1]:30015":             {},
+		"prod":                    {Hosts: []string{"hana1:30015"}},
+		"default":                 {},
+	}}
+	if err := c.parseTargetKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		// Host names are case-insensitive, as in the duplicate check.
+		{"hana1.example.com:30015", "HANA1.example.com:30015"},
+		{"HANA1.EXAMPLE.COM:30015", "HANA1.example.com:30015"},
+		{"hana1.example.com:30041", "default"},
+		{"[::1]:30015", "[::1]:30015"},
+		// The names of logical targets are not host names.
+		{"prod", "prod"},
+		{"PROD", "default"},
+	}
+	for _, test := range tests {
+		if got := selectedKey(c, test.target); got != test.want {
+			t.Errorf("target %s uses %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestMatchTargetOrder(t *testing.T) {
+	c := &Config{Databases: map[string]DatabaseConfig{
+		"default":          {},
+		"~h.*:30015":       {},
+		"h*:30015":         {},
+		"10.0.0.0/8:30015": {},
+		"h1:30015":         {},
+		"b*:30015":         {},
+		"10.1.0.0/16:*":    {},
+	}}
+	if err := c.parseTargetKeys(); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ key, kind string }{
+		{"h1:30015", MatchExact},
+		{"10.1.0.0/16:*", MatchCIDR},
+		{"10.0.0.0/8:30015", MatchCIDR},
+		{"b*:30015", MatchGlob},
+		{"h*:30015", MatchGlob},
+		{"~h.*:30015", MatchRegex},
+		{"default", MatchDefault},
+	}
+	got := c.MatchTarget("x:1")
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Key != want[i].key || got[i].Kind != want[i].kind {
+			t.Errorf("key %d is %s (%s), want %s (%s)", i, got[i].Key, got[i].Kind, want[i].key, want[i].kind)
+		}
+	}
+}
+
+func TestParseTargetKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		kind    string
+		wantErr bool
+	}{
+		{key: "default", kind: MatchDefault},
+		{key: "host:30015", kind: MatchExact},
+		{key: "[::1]:30015", kind: MatchExact},
+		{key: "10.0.0.0/8:30015", kind: MatchCIDR},
+		{key: "10.0.0.0/8:3*", kind: MatchCIDR},
+		{key: "host*:30015", kind: MatchGlob},
+		{key: "~host[0-9]+:30015", kind: MatchRegex},
+		{key: "host", wantErr: true},
+		{key: "host:0", wantErr: true},
+		{key: "host:65536", wantErr: true},
+		{key: ":30015", wantErr: true},
+		{key: "10.0.0.0/33:30015", wantErr: true},
+		{key: "10.0.0.0/8:[", wantErr: true},
+		{key: "host[:30015", wantErr: true},
+		{key: "~host(:30015", wantErr: true},
+	}
+	for _, test := range tests {
+		k, err := parseTargetKey(test.key)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("key %s: expected an error, got kind %s", test.key, k.kind)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("key %s: %s", test.key, err)
+			continue
+		}
+		if k.kind != test.kind {
+			t.Errorf("key %s is %s, want %s", test.key, k.kind, test.kind)
+		}
+	}
+}
+
+func TestIsTarget(t *testing.T) {
+	tests := []struct {
+		key            string
+		databaseConfig DatabaseConfig
+		want           bool
+	}{
+		{"host:30015", DatabaseConfig{}, true},
+		{"host*:30015", DatabaseConfig{}, false},
+		{"default", DatabaseConfig{}, false},
+		{"prod", DatabaseConfig{Hosts: []string{"a:30015", "b:30015"}}, true},
+		{"h*:30015", DatabaseConfig{Hosts: []string{"a:30015"}}, false},
+	}
+	for _, test := range tests {
+		if got := IsTarget(test.key, test.databaseConfig); got != test.want {
+			t.Errorf("IsTarget(%s) = %t, want %t", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+// TargetGroup is a target group in the format of the Prometheus HTTP and
+// file service discovery.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// moduleParamLabel passes the module of a target as the module parameter
+// of its scrapes.
+const moduleParamLabel = "__param_module"
+
+// TargetGroups returns a target group for every target of the databases
+// section with its labels and module, sorted by target. The patterns and
+// the default are left out. It is concurrency-safe.
+func (sc *SafeConfig) TargetGroups() []TargetGroup {
+	sc.RLock()
+	defer sc.RUnlock()
+	groups := []TargetGroup{}
+	for _, target := range sortedKeys(sc.C.Databases) {
+		databaseConfig := sc.C.Databases[target]
+		if !IsTarget(target, databaseConfig) {
+			continue
+		}
+		group := TargetGroup{Targets: []string{target}}
+		if len(databaseConfig.Labels) > 0 || databaseConfig.Module != "" {
+			group.Labels = make(map[string]string, len(databaseConfig.Labels)+1)
+			for name, value := range databaseConfig.Labels {
+				group.Labels[name] = value
+			}
+			if databaseConfig.Module != "" {
+				group.Labels[moduleParamLabel] = databaseConfig.Module
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTargetGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hana.yml")
+	content := `databases:
+  hana2:30015:
+    user: SYSTEM
+    module: quick
+    labels:
+      env: prod
+  hana1:30015:
+    user: SYSTEM
+  prod:
+    user: SYSTEM
+    hosts: [hana3:30015, hana4:30015]
+    labels:
+      sap_system: PRD
+  10.0.0.0/8:30015:
+    user: SYSTEM
+  hana*:30015:
+    user: SYSTEM
+  ~hana[0-9]+:30013:
+    user: SYSTEM
+  default:
+    user: SYSTEM
+modules:
+  quick:
+    collectors: [sys_m_disks]
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sc := &SafeConfig{C: &Config{}}
+	if err := sc.ReloadConfig(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The patterns and the default are left out, the targets are sorted.
+	got, err := json.Marshal(sc.TargetGroups())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"targets":["hana1:30015"]},` +
+		`{"targets":["hana2:30015"],"labels":{"__param_module":"quick","env":"prod"}},` +
+		`{"targets":["prod"],"labels":{"sap_system":"PRD"}}]`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTargetGroupsEmpty(t *testing.T) {
+	sc := &SafeConfig{C: &Config{}}
+	// An empty list, not null, is valid service discovery.
+	got, err := json.Marshal(sc.TargetGroups())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "[]" {
+		t.Errorf("got %s, want []", got)
+	}
+}
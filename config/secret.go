@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// passwordCommandTimeout limits the run of a credential helper.
+const passwordCommandTimeout = 10 * time.Second
+
+// envRE matches the ${NAME} references to environment variables.
+var envRE = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in s by the value of the
+// environment variable NAME. Other uses of $ are kept, so that passwords
+// may contain them. The error names the missing variable only.
+func expandEnv(s string) (string, error) {
+	var missing string
+	expanded := envRE.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRE.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
+
+// readPasswordFile returns the content of the password file at path,
+// without the trailing newline.
+func readPasswordFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// runPasswordCommand runs the credential helper args and returns its
+// standard output, without the trailing newline. Its output is left out of
+// the errors.
+func runPasswordCommand(args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s: %s", args[0], err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// resolve expands the environment variables in the user, password and
+// password file of the database, and sets the password from the password
+// file or the credential helper. name is the key of the database, used in
+// the errors, which never contain the password.
+func (c *DatabaseConfig) resolve(name string) error {
+	sources := 0
+	for _, set := range []bool{c.Password != "", c.PasswordFile != "", len(c.PasswordCommand) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("database %s: only one of pass, pass_file and exec may be set", name)
+	}
+
+	var err error
+	if c.User, err = expandEnv(c.User); err != nil {
+		return fmt.Errorf("database %s: user: %s", name, err)
+	}
+	if c.Password, err = expandEnv(c.Password); err != nil {
+		return fmt.Errorf("database %s: pass: %s", name, err)
+	}
+	if c.SystemDBUser, err = expandEnv(c.SystemDBUser); err != nil {
+		return fmt.Errorf("database %s: systemdb_user: %s", name, err)
+	}
+	if c.SystemDBPassword, err = expandEnv(c.SystemDBPassword); err != nil {
+		return fmt.Errorf("database %s: systemdb_pass: %s", name, err)
+	}
+	if c.PasswordFile != "" {
+		if c.PasswordFile, err = expandEnv(c.PasswordFile); err != nil {
+			return fmt.Errorf("database %s: pass_file: %s", name, err)
+		}
+		if c.Password, err = readPasswordFile(c.PasswordFile); err != nil {
+			return fmt.Errorf("database %s: pass_file: %s", name, err)
+		}
+	}
+	if len(c.PasswordCommand) > 0 {
+		if c.Password, err = runPasswordCommand(c.PasswordCommand); err != nil {
+			return fmt.Errorf("database %s: exec: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// CurrentPassword returns the password of the database, read again from the
+// password file if any.
+func (c DatabaseConfig) CurrentPassword() (string, error) {
+	if c.PasswordFile == "" {
+		return c.Password, nil
+	}
+	password, err := readPasswordFile(c.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("reading pass_file: %s", err)
+	}
+	return password, nil
+}
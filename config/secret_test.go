@@ -0,0 +1,161 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("HANA_EXPORTER_TEST_USER", "monitor")
+	defer os.Unsetenv("HANA_EXPORTER_TEST_USER")
+	os.Unsetenv("HANA_EXPORTER_TEST_MISSING")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${HANA_EXPORTER_TEST_USER}", want: "monitor"},
+		{in: "a${HANA_EXPORTER_TEST_USER}b", want: "amonitorb"},
+		// Other uses of $ are kept.
+		{in: "pa$$word$HANA_EXPORTER_TEST_USER", want: "pa$$word$HANA_EXPORTER_TEST_USER"},
+		{in: "${1NVALID}", want: "${1NVALID}"},
+		{in: "${HANA_EXPORTER_TEST_MISSING}", wantErr: "environment variable HANA_EXPORTER_TEST_MISSING is not set"},
+	}
+	for _, test := range tests {
+		got, err := expandEnv(test.in)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("expandEnv(%q): got error %v, want %q", test.in, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expandEnv(%q): %s", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expandEnv(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passFile := filepath.Join(dir, "pass")
+	if err := ioutil.WriteFile(passFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("HANA_EXPORTER_TEST_DIR", dir)
+	defer os.Unsetenv("HANA_EXPORTER_TEST_DIR")
+
+	tests := []struct {
+		name     string
+		config   DatabaseConfig
+		password string
+		wantErr  string
+	}{
+		{
+			name:     "pass",
+			config:   DatabaseConfig{User: "u", Password: "secret"},
+			password: "secret",
+		},
+		{
+			name:     "pass_file",
+			config:   DatabaseConfig{User: "u", PasswordFile: "${HANA_EXPORTER_TEST_DIR}/pass"},
+			password: "from-file",
+		},
+		{
+			name:     "exec",
+			config:   DatabaseConfig{User: "u", PasswordCommand: []string{"echo", "from-exec"}},
+			password: "from-exec",
+		},
+		{
+			name:    "pass and pass_file",
+			config:  DatabaseConfig{User: "u", Password: "secret", PasswordFile: passFile},
+			wantErr: "only one of pass, pass_file and exec may be set",
+		},
+		{
+			name:    "pass_file and exec",
+			config:  DatabaseConfig{User: "u", PasswordFile: passFile, PasswordCommand: []string{"true"}},
+			wantErr: "only one of pass, pass_file and exec may be set",
+		},
+		{
+			name:    "missing pass_file",
+			config:  DatabaseConfig{User: "u", PasswordFile: filepath.Join(dir, "missing")},
+			wantErr: "pass_file:",
+		},
+		{
+			name:    "failing exec",
+			config:  DatabaseConfig{User: "u", PasswordCommand: []string{"false"}},
+			wantErr: "exec: running false",
+		},
+		{
+			name:    "missing variable",
+			config:  DatabaseConfig{User: "${HANA_EXPORTER_TEST_MISSING}", Password: "secret"},
+			wantErr: "user: environment variable",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.config
+			err := c.resolve("host:30015")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "from-") {
+					t.Errorf("error %q contains the password", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Password != test.password {
+				t.Errorf("password is %q, want %q", c.Password, test.password)
+			}
+		})
+	}
+}
+
+func TestCurrentPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passFile := filepath.Join(dir, "pass")
+	if err := ioutil.WriteFile(passFile, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := DatabaseConfig{User: "u", PasswordFile: passFile}
+	if err := c.resolve("host:30015"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The password file is read again, so that a rotated password applies
+	// without a reload.
+	if err := ioutil.WriteFile(passFile, []byte("new\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	password, err := c.CurrentPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "new" {
+		t.Errorf("password is %q, want %q", password, "new")
+	}
+	os.Remove(passFile)
+	if _, err := c.CurrentPassword(); err == nil {
+		t.Error("expected an error for a removed pass_file")
+	}
+}
@@ -0,0 +1,286 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists the semantic errors of a config file.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// JoinErrors returns the non-nil errors as a single ValidationError, or nil
+// if there are none.
+func JoinErrors(errs ...error) error {
+	var joined ValidationError
+	for _, err := range errs {
+		switch err := err.(type) {
+		case nil:
+		case ValidationError:
+			joined = append(joined, err...)
+		default:
+			joined = append(joined, err.Error())
+		}
+	}
+	if len(joined) > 0 {
+		return joined
+	}
+	return nil
+}
+
+// errorList collects the errors of a config file, prefixed with the line of
+// the key they refer to where possible.
+type errorList struct {
+	content []byte
+	errs    ValidationError
+}
+
+// add adds an error about key of the given top-level section.
+func (l *errorList) add(section, key string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if line := keyLine(l.content, section, key); line > 0 {
+		msg = fmt.Sprintf("line %d: %s", line, msg)
+	}
+	l.errs = append(l.errs, msg)
+}
+
+// err returns the collected errors, if any.
+func (l *errorList) err() error {
+	if len(l.errs) > 0 {
+		return l.errs
+	}
+	return nil
+}
+
+// validate checks the semantics of c, parsed from content. The errors refer
+// to the lines of content where possible.
+func (c *Config) validate(content []byte) error {
+	errs := &errorList{content: content}
+	add := errs.add
+
+	targets := make(map[string]string, len(c.Databases))
+	for _, name := range sortedKeys(c.Databases) {
+		databaseConfig := c.Databases[name]
+		if strings.TrimSpace(databaseConfig.User) == "" {
+			add("databases", name, "database %s: user is empty", name)
+		}
+		if databaseConfig.Module != "" {
+			if _, ok := c.Modules[databaseConfig.Module]; !ok {
+				add("databases", name, "database %s: unknown module %s", name, databaseConfig.Module)
+			}
+		}
+		if databaseConfig.DatabaseName != "" && databaseConfig.MultiTenant {
+			add("databases", name, "database %s: database_name and multi_tenant are exclusive", name)
+		}
+		if databaseConfig.DatabaseName == "" && (databaseConfig.DatabasePort != 0 || databaseConfig.SystemDBUser != "") {
+			add("databases", name, "database %s: database_port and systemdb_user require database_name", name)
+		}
+		if databaseConfig.DatabasePort < 0 || databaseConfig.DatabasePort > 65535 {
+			add("databases", name, "database %s: invalid database_port %d", name, databaseConfig.DatabasePort)
+		}
+		if (databaseConfig.SystemDBUser == "") != (databaseConfig.SystemDBPassword == "") {
+			add("databases", name, "database %s: systemdb_user and systemdb_pass must be set together", name)
+		}
+		for _, variable := range sortedKeys(databaseConfig.SessionVariables) {
+			if strings.TrimSpace(variable) == "" {
+				add("databases", name, "database %s: empty session variable name", name)
+			}
+		}
+		for _, label := range sortedKeys(databaseConfig.Labels) {
+			if !nameRE.MatchString(label) || strings.HasPrefix(label, "__") {
+				add("databases", name, "database %s: invalid label name %q", name, label)
+			}
+		}
+		k, err := parseDatabaseKey(name, databaseConfig)
+		if err != nil && len(databaseConfig.Hosts) > 0 {
+			add("databases", name, "database %s: %s", name, err)
+			continue
+		}
+		if err != nil {
+			add("databases", name, "database %s: target is not host:port or a pattern: %s", name, err)
+			continue
+		}
+		if len(databaseConfig.Hosts) > 0 {
+			for _, candidate := range databaseConfig.Hosts {
+				host, port, err := net.SplitHostPort(candidate)
+				if err == nil {
+					err = checkHostPort(host, port)
+				}
+				if err != nil {
+					add("databases", name, "database %s: host %s is not host:port: %s", name, candidate, err)
+				}
+			}
+			continue
+		}
+		if k.kind != MatchExact {
+			continue
+		}
+		target := normalizeTarget(name)
+		if other, ok := targets[target]; ok {
+			add("databases", name, "database %s: duplicate of target %s", name, other)
+		} else {
+			targets[target] = name
+		}
+	}
+
+	for _, name := range sortedKeys(c.Modules) {
+		seen := make(map[string]bool, len(c.Modules[name].Collectors))
+		for _, collector := range c.Modules[name].Collectors {
+			if seen[collector] {
+				add("modules", name, "module %s: duplicate collector %s", name, collector)
+			}
+			seen[collector] = true
+		}
+	}
+
+	for _, name := range sortedKeys(c.Queries) {
+		if err := c.Queries[name].validate(name); err != nil {
+			add("queries", name, "%s", err)
+		}
+		for _, module := range c.Queries[name].Modules {
+			if _, ok := c.Modules[module]; !ok {
+				add("queries", name, "query %s: unknown module %s", name, module)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// CheckCollectors checks that the collectors named in c are built-in
+// collectors, as reported by builtin, or custom queries, and that no custom
+// query is named like a built-in collector.
+func (c *Config) CheckCollectors(builtin func(name string) bool) error {
+	errs := &errorList{content: c.content}
+	known := func(name string) bool {
+		_, ok := c.Queries[name]
+		return ok || builtin(name)
+	}
+	for _, name := range sortedKeys(c.Queries) {
+		if builtin(name) {
+			errs.add("queries", name, "query %s: name of a built-in collector", name)
+		}
+	}
+	for _, name := range sortedKeys(c.Collectors) {
+		if !known(name) {
+			errs.add("collectors", name, "collectors: unknown collector %s", name)
+		}
+	}
+	for _, name := range sortedKeys(c.Modules) {
+		module := c.Modules[name]
+		for _, collector := range module.Collectors {
+			if !known(collector) {
+				errs.add("modules", name, "module %s: unknown collector %s", name, collector)
+			}
+		}
+		for _, collector := range sortedKeys(module.CollectorConfigs) {
+			if !known(collector) {
+				errs.add("modules", name, "module %s: collector_config of unknown collector %s", name, collector)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// CheckLabels checks that the labels of the databases of c are not among
+// reserved, the labels of the metrics they are added to.
+func (c *Config) CheckLabels(reserved []string) error {
+	errs := &errorList{content: c.content}
+	isReserved := make(map[string]bool, len(reserved))
+	for _, name := range reserved {
+		isReserved[name] = true
+	}
+	for _, name := range sortedKeys(c.Databases) {
+		for _, label := range sortedKeys(c.Databases[name].Labels) {
+			if isReserved[label] {
+				errs.add("databases", name, "database %s: label %s is reserved by the metrics", name, label)
+			}
+		}
+	}
+	return errs.err()
+}
+
+// CheckMetricNames checks that the metrics of the custom queries of c, given
+// by metricNames for each query, are not named like the metrics in reserved
+// or like the metrics of another query.
+func (c *Config) CheckMetricNames(reserved []string, metricNames map[string][]string) error {
+	errs := &errorList{content: c.content}
+	isReserved := make(map[string]bool, len(reserved))
+	for _, name := range reserved {
+		isReserved[name] = true
+	}
+	queries := make(map[string]string)
+	for _, name := range sortedKeys(c.Queries) {
+		for _, metric := range metricNames[name] {
+			if isReserved[metric] {
+				errs.add("queries", name, "query %s: metric %s is reserved by the exporter", name, metric)
+				continue
+			}
+			if other, ok := queries[metric]; ok {
+				errs.add("queries", name, "query %s: metric %s is also exported by query %s", name, metric, other)
+				continue
+			}
+			queries[metric] = name
+		}
+	}
+	return errs.err()
+}
+
+// sortedKeys returns the keys of a section of the config file in order.
+func sortedKeys(section interface{}) []string {
+	var keys []string
+	switch m := section.(type) {
+	case map[string]DatabaseConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]CollectorConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]ModuleConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]QueryConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyLine returns the number of the first line of content with key as a
+// mapping key within the given top-level section, or 0 if there is none.
+func keyLine(content []byte, section, key string) int {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	inSection := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text != "" && text[0] != ' ' && text[0] != '\t' && text[0] != '#' {
+			inSection = strings.HasPrefix(text, section+":")
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		text = strings.TrimSpace(text)
+		for _, quoted := range []string{key, `"` + key + `"`, "'" + key + "'"} {
+			if strings.HasPrefix(text, quoted+":") {
+				return line
+			}
+		}
+	}
+	return 0
+}
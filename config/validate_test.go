@@ -0,0 +1,228 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadString loads a config file with the given content and checks.
+func loadString(t *testing.T, content string, checks ...func(*Config) error) (*Config, error) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hana.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadFile(file, checks...)
+}
+
+func TestLoadFileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// errs are the expected errors, in order, empty if the file is
+		// valid.
+		errs []string
+	}{
+		{
+			name: "valid",
+			content: `databases:
+  host1:30015:
+    user: SYSTEM
+    pass: secret
+  10.0.0.0/8:30015:
+    user: SYSTEM
+  default:
+    user: SYSTEM
+`,
+		},
+		{
+			name: "unknown key",
+			content: `databases:
+  host1:30015:
+    user: SYSTEM
+    password: secret
+`,
+			errs: []string{
+				"yaml: unmarshal errors:",
+				"line 4: field password not found",
+			},
+		},
+		{
+			name: "empty user",
+			content: `databases:
+  host1:30015:
+    pass: secret
+  host2:30015:
+    user: " "
+`,
+			errs: []string{
+				"line 2: database host1:30015: user is empty",
+				"line 4: database host2:30015: user is empty",
+			},
+		},
+		{
+			name: "malformed targets",
+			content: `databases:
+  host1:
+    user: SYSTEM
+  host1:99999:
+    user: SYSTEM
+  "10.0.0.0/33:30015":
+    user: SYSTEM
+`,
+			errs: []string{
+				"line 6: database 10.0.0.0/33:30015: target is not host:port or a pattern",
+				"line 2: database host1: target is not host:port or a pattern",
+				`line 4: database host1:99999: target is not host:port or a pattern: invalid port "99999"`,
+			},
+		},
+		{
+			name: "duplicate targets",
+			content: `databases:
+  host1:30015:
+    user: SYSTEM
+  HOST1:30015:
+    user: SYSTEM
+`,
+			errs: []string{"line 2: database host1:30015: duplicate of target HOST1:30015"},
+		},
+		{
+			name: "tenant settings",
+			content: `databases:
+  host1:30013:
+    user: SYSTEM
+    database_port: 30015
+  host2:30013:
+    user: MONITOR
+    database_name: HDB
+    database_port: 70000
+    systemdb_user: SYSTEM
+`,
+			errs: []string{
+				"line 2: database host1:30013: database_port and systemdb_user require database_name",
+				"line 5: database host2:30013: invalid database_port 70000",
+				"line 5: database host2:30013: systemdb_user and systemdb_pass must be set together",
+			},
+		},
+		{
+			name: "unknown module and invalid label",
+			content: `databases:
+  host1:30015:
+    user: SYSTEM
+    module: missing
+    labels:
+      __env: prod
+modules:
+  app:
+    collectors: [a, a]
+`,
+			errs: []string{
+				"line 2: database host1:30015: unknown module missing",
+				`line 2: database host1:30015: invalid label name "__env"`,
+				"line 8: module app: duplicate collector a",
+			},
+		},
+		{
+			name: "logical target",
+			content: `databases:
+  prod:
+    user: SYSTEM
+    hosts: [a:30015, b]
+  h*:30015:
+    user: SYSTEM
+    hosts: [a:30015]
+`,
+			errs: []string{
+				"line 5: database h*:30015: a glob key cannot have hosts",
+				"line 2: database prod: host b is not host:port",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadString(t, test.content)
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			got := strings.Split(err.Error(), "\n")
+			if len(got) != len(test.errs) {
+				t.Fatalf("got errors %q, want %q", got, test.errs)
+			}
+			for i, want := range test.errs {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("error %d is %q, want %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileChecks(t *testing.T) {
+	content := `databases:
+  host1:30015:
+    user: ""
+    labels:
+      collector: x
+collectors:
+  unknown: {}
+`
+	check := func(c *Config) error {
+		builtin := func(string) bool { return false }
+		return JoinErrors(c.CheckCollectors(builtin), c.CheckLabels([]string{"collector"}))
+	}
+	want := []string{
+		"line 2: database host1:30015: user is empty",
+		"line 7: collectors: unknown collector unknown",
+		"line 2: database host1:30015: label collector is reserved by the metrics",
+	}
+
+	// The checks run even though the validation fails.
+	_, err := loadString(t, content, check)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
+
+func TestKeyLine(t *testing.T) {
+	content := []byte(`# comment
+databases:
+  host1:30015:
+    user: SYSTEM
+  "host2:30015":
+    user: SYSTEM
+modules:
+  host1:30015:
+    collectors: []
+`)
+	tests := []struct {
+		section, key string
+		want         int
+	}{
+		{"databases", "host1:30015", 3},
+		{"databases", "host2:30015", 5},
+		{"modules", "host1:30015", 8},
+		{"queries", "host1:30015", 0},
+		{"databases", "host3:30015", 0},
+	}
+	for _, test := range tests {
+		if got := keyLine(content, test.section, test.key); got != test.want {
+			t.Errorf("keyLine(%s, %s) = %d, want %d", test.section, test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WebConfig is the Go representation of the web config file, in the format
+// of the Prometheus exporter-toolkit.
+//
+// The exporter-toolkit itself cannot be used: its releases require newer
+// versions of Go, client_golang and prometheus/common (which dropped the
+// common/log package this exporter logs with) than this exporter is built
+// with. The files the toolkit accepts are loaded the same way, e.g. relative
+// paths are resolved against the directory of the web config file, except
+// that the inline cert, key and client_ca and client_allowed_sans are not
+// supported and rejected as unknown keys.
+type WebConfig struct {
+	TLSConfig  WebTLSConfig  `yaml:"tls_server_config"`
+	HTTPConfig WebHTTPConfig `yaml:"http_server_config"`
+	// Users are the basic authentication users with their bcrypt hashed
+	// passwords.
+	Users map[string]string `yaml:"basic_auth_users"`
+}
+
+// WebHTTPConfig is the HTTP configuration of the server.
+type WebHTTPConfig struct {
+	// HTTP2 enables HTTP/2 over TLS, the default. It only changes with a
+	// restart.
+	HTTP2 *bool `yaml:"http2"`
+	// Headers are added to every response, only the security headers of
+	// allowedHeaders may be set, some only to the values listed there.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// HTTP2Enabled reports whether HTTP/2 is served over TLS.
+func (c WebHTTPConfig) HTTP2Enabled() bool {
+	return c.HTTP2 == nil || *c.HTTP2
+}
+
+// allowedHeaders are the response headers which may be set in the web
+// config file, with their allowed values if restricted, as in the
+// Prometheus exporter-toolkit.
+var allowedHeaders = map[string][]string{
+	"Strict-Transport-Security": nil,
+	"X-Frame-Options":           {"deny", "sameorigin"},
+	"X-Content-Type-Options":    {"nosniff"},
+	"X-XSS-Protection":          nil,
+	"Content-Security-Policy":   nil,
+}
+
+// WebTLSConfig is the TLS configuration of the HTTP server.
+type WebTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuth is the policy for client certificates, e.g.
+	// RequireAndVerifyClientCert, verified against ClientCAFile or else
+	// the system roots.
+	ClientAuth               string   `yaml:"client_auth_type"`
+	ClientCAFile             string   `yaml:"client_ca_file"`
+	MinVersion               string   `yaml:"min_version"`
+	MaxVersion               string   `yaml:"max_version"`
+	CipherSuites             []string `yaml:"cipher_suites"`
+	PreferServerCipherSuites bool     `yaml:"prefer_server_cipher_suites"`
+	// CurvePreferences are the names of the elliptic curves, in order of
+	// preference, e.g. X25519.
+	CurvePreferences []string `yaml:"curve_preferences"`
+}
+
+// clientAuthTypes maps the names of the policies for client certificates.
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"RequireClientCert":          tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// tlsVersions maps the names of the TLS versions.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// curves maps the names of the elliptic curves.
+var curves = map[string]tls.CurveID{
+	"CurveP256": tls.CurveP256,
+	"CurveP384": tls.CurveP384,
+	"CurveP521": tls.CurveP521,
+	"X25519":    tls.X25519,
+}
+
+// cipherSuites maps the names of the cipher suites known to Go 1.12, as
+// named by the exporter-toolkit, including the RSA key exchange suites
+// which newer Go releases list as insecure.
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                      tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":                 tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":               tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":              tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":                tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_AES_128_GCM_SHA256":                        tls.TLS_AES_128_GCM_SHA256,
+	"TLS_AES_256_GCM_SHA384":                        tls.TLS_AES_256_GCM_SHA384,
+	"TLS_CHACHA20_POLY1305_SHA256":                  tls.TLS_CHACHA20_POLY1305_SHA256,
+}
+
+// http2CipherSuites are the cipher suites of which HTTP/2 requires one.
+var http2CipherSuites = map[uint16]bool{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   true,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: true,
+}
+
+// LoadWebConfig parses and checks the web config file. An empty file name
+// returns an empty config, without TLS and authentication. The relative
+// paths of the TLS files are resolved against the directory of the file.
+func LoadWebConfig(webConfigFile string) (*WebConfig, error) {
+	c := &WebConfig{}
+	if webConfigFile == "" {
+		return c, nil
+	}
+	content, err := ioutil.ReadFile(webConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	// The server prefers its cipher suites unless told otherwise, as in
+	// the exporter-toolkit.
+	c.TLSConfig.PreferServerCipherSuites = true
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(webConfigFile)
+	for _, file := range []*string{&c.TLSConfig.CertFile, &c.TLSConfig.KeyFile, &c.TLSConfig.ClientCAFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(dir, *file)
+		}
+	}
+	for _, user := range sortedKeys(c.Users) {
+		if _, err := bcrypt.Cost([]byte(c.Users[user])); err != nil {
+			return nil, fmt.Errorf("basic_auth_users: %s: %s", user, err)
+		}
+	}
+	for _, name := range sortedKeys(c.HTTPConfig.Headers) {
+		values, ok := allowedHeaders[name]
+		if !ok {
+			return nil, fmt.Errorf("http_server_config: headers: %s cannot be set", name)
+		}
+		if len(values) > 0 && !containsFold(values, c.HTTPConfig.Headers[name]) {
+			return nil, fmt.Errorf("http_server_config: headers: invalid value %q for %s, expected one of %q", c.HTTPConfig.Headers[name], name, values)
+		}
+	}
+	if c.TLSConfig.Enabled() {
+		tlsConfig, err := c.TLSConfig.ServerConfig()
+		if err != nil {
+			return nil, fmt.Errorf("tls_server_config: %s", err)
+		}
+		if c.HTTPConfig.HTTP2Enabled() && !hasHTTP2CipherSuite(tlsConfig) {
+			return nil, fmt.Errorf("tls_server_config: cipher_suites: HTTP/2 requires TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, or set http2 to false")
+		}
+	}
+	return c, nil
+}
+
+// containsFold reports whether values holds value, ignoring the case.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHTTP2CipherSuite reports whether tlsConfig allows a cipher suite that
+// HTTP/2 requires. The default cipher suites, and those of TLS 1.3, always
+// do.
+func hasHTTP2CipherSuite(tlsConfig *tls.Config) bool {
+	if len(tlsConfig.CipherSuites) == 0 || tlsConfig.MinVersion >= tls.VersionTLS13 {
+		return true
+	}
+	for _, id := range tlsConfig.CipherSuites {
+		if http2CipherSuites[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether the HTTP server uses TLS.
+func (c WebTLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// ServerConfig returns the TLS configuration of the HTTP server, with the
+// certificate and the client CAs read from their files.
+func (c WebTLSConfig) ServerConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("both cert_file and key_file must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		MaxVersion:   tls.VersionTLS13,
+	}
+
+	clientAuth, ok := clientAuthTypes[c.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("invalid client_auth_type %q", c.ClientAuth)
+	}
+	tlsConfig.ClientAuth = clientAuth
+	if c.ClientCAFile != "" {
+		if clientAuth == tls.NoClientCert {
+			return nil, fmt.Errorf("client_ca_file is set without a client_auth_type")
+		}
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.ClientCAFile)
+		}
+	}
+
+	if c.MinVersion != "" {
+		if tlsConfig.MinVersion, ok = tlsVersions[c.MinVersion]; !ok {
+			return nil, fmt.Errorf("invalid min_version %q", c.MinVersion)
+		}
+	}
+	if c.MaxVersion != "" {
+		if tlsConfig.MaxVersion, ok = tlsVersions[c.MaxVersion]; !ok {
+			return nil, fmt.Errorf("invalid max_version %q", c.MaxVersion)
+		}
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid cipher suite %q", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+	tlsConfig.PreferServerCipherSuites = c.PreferServerCipherSuites
+	for _, name := range c.CurvePreferences {
+		id, ok := curves[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid curve %q", name)
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, id)
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoadWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certFile, keyFile)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := string(hashed)
+
+	tests := []struct {
+		name    string
+		content string
+		check   func(*testing.T, *WebConfig)
+		wantErr string
+	}{
+		{
+			name: "exporter-toolkit",
+			content: `tls_server_config:
+  cert_file: ` + certFile + `
+  key_file: ` + keyFile + `
+  min_version: TLS12
+  max_version: TLS13
+  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]
+  prefer_server_cipher_suites: true
+  curve_preferences: [X25519, CurveP256]
+http_server_config:
+  http2: false
+  headers:
+    Strict-Transport-Security: max-age=31536000
+basic_auth_users:
+  prometheus: ` + hash + `
+`,
+			check: func(t *testing.T, c *WebConfig) {
+				if c.HTTPConfig.HTTP2Enabled() {
+					t.Error("HTTP/2 is enabled")
+				}
+				tlsConfig, err := c.TLSConfig.ServerConfig()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tlsConfig.PreferServerCipherSuites {
+					t.Error("prefer_server_cipher_suites is not set")
+				}
+				if len(tlsConfig.CurvePreferences) != 2 || tlsConfig.CurvePreferences[0] != tls.X25519 {
+					t.Errorf("curve preferences %v", tlsConfig.CurvePreferences)
+				}
+				if tlsConfig.MaxVersion != tls.VersionTLS13 {
+					t.Errorf("max version %x", tlsConfig.MaxVersion)
+				}
+			},
+		},
+		{
+			name:    "empty",
+			content: "",
+			check: func(t *testing.T, c *WebConfig) {
+				if c.TLSConfig.Enabled() || !c.HTTPConfig.HTTP2Enabled() {
+					t.Error("an empty file changes the defaults")
+				}
+			},
+		},
+		{
+			name:    "unknown key",
+			content: "tls_server_config:\n  certfile: x\n",
+			wantErr: "field certfile not found",
+		},
+		{
+			name:    "invalid header",
+			content: "http_server_config:\n  headers:\n    Server: hana\n",
+			wantErr: "Server cannot be set",
+		},
+		{
+			name:    "invalid curve",
+			content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  curve_preferences: [P999]\n",
+			wantErr: `invalid curve "P999"`,
+		},
+		{
+			name:    "invalid hash",
+			content: "basic_auth_users:\n  prometheus: secret\n",
+			wantErr: "basic_auth_users: prometheus",
+		},
+		{
+			name:    "client CA without policy",
+			content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_ca_file: " + certFile + "\n",
+			wantErr: "client_ca_file is set without a client_auth_type",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, "web.yml")
+			if err := ioutil.WriteFile(file, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := LoadWebConfig(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+// TestLoadWebConfigToolkit loads the web config files of the tests of the
+// Prometheus exporter-toolkit, with relative paths to the TLS files.
+func TestLoadWebConfigToolkit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeKeyPair(t, filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	writeKeyPair(t, filepath.Join(dir, "client_selfsigned.pem"), filepath.Join(dir, "client_selfsigned.key"))
+
+	tls := "tls_server_config:\n  cert_file: \"server.crt\"\n  key_file: \"server.key\"\n"
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "web_config_empty", content: ""},
+		{name: "web_config_junk_key", content: "tls_server_config:\n  cert_filse: \"server.crt\"\n", wantErr: "field cert_filse not found"},
+		{name: "web_config_noAuth_certPath_empty", content: "tls_server_config:\n  cert_file: \"\"\n  key_file: \"server.key\"\n", wantErr: "both cert_file and key_file must be set"},
+		{name: "web_config_noAuth_keyPath_empty", content: "tls_server_config:\n  cert_file: \"server.crt\"\n  key_file: \"\"\n", wantErr: "both cert_file and key_file must be set"},
+		{name: "web_config_noAuth_certPath_invalid", content: "tls_server_config:\n  cert_file: \"somefile\"\n  key_file: \"server.key\"\n", wantErr: "no such file"},
+		{name: "web_config_noAuth.bad", content: tls + "  client_ca_file: \"/dev/null\"\n", wantErr: "client_ca_file is set without a client_auth_type"},
+		{name: "web_config_auth_clientCAs_invalid", content: tls + "  client_ca_file: \"somefile\"\n", wantErr: "client_ca_file is set without a client_auth_type"},
+		{name: "web_config_auth_user_list_invalid", content: tls + "basic_auth_users:\n  john: doe\n", wantErr: "hashedSecret too short"},
+		{name: "web_config_noAuth.good", content: tls + "  client_auth_type: \"VerifyClientCertIfGiven\"\n"},
+		{name: "web_config_noAuth.good.blocking", content: tls + "  client_auth_type: \"RequireAndVerifyClientCert\"\n"},
+		{name: "tls_config_noAuth.requireanyclientcert", content: tls + "  client_auth_type: \"RequireAnyClientCert\"\n"},
+		{name: "tls_config_noAuth.requireandverifyclientcert", content: tls + "  client_auth_type: \"RequireAndVerifyClientCert\"\n  client_ca_file: \"client_selfsigned.pem\"\n"},
+		{name: "web_config_noAuth_allCurves", content: tls + "  curve_preferences:\n    - CurveP256\n    - CurveP384\n    - CurveP521\n    - X25519\n"},
+		{name: "web_config_noAuth_inventedCiphers", content: tls + "  cipher_suites:\n  - TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA2048\n", wantErr: "invalid cipher suite"},
+		{name: "web_config_noAuth_inventedCurves", content: tls + "  curve_preferences:\n    - CurveP257\n", wantErr: "invalid curve"},
+		{name: "web_config_noAuth_wrongTLSVersion", content: tls + "  min_version: TLS111\n", wantErr: "invalid min_version"},
+		{name: "web_config_noAuth_someCiphers", content: tls + "  cipher_suites:\n  - TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n  - TLS_RSA_WITH_AES_128_CBC_SHA\n  min_version: TLS12\n  max_version: TLS12\n"},
+		{name: "web_config_noAuth_someCiphers_noOrder", content: tls + "  cipher_suites:\n  - TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384\n  - TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n  prefer_server_cipher_suites: false\n  min_version: TLS12\n  max_version: TLS12\n"},
+		{name: "web_config_noAuth_someCurves", content: tls + "  min_version: TLS13\n  curve_preferences:\n  - CurveP521\n"},
+		{name: "web_config_noAuth_noHTTP2", content: tls + "  cipher_suites:\n    - TLS_RSA_WITH_AES_128_CBC_SHA\n  max_version: TLS12\nhttp_server_config:\n  http2: false\n"},
+		{name: "web_config_noAuth_noHTTP2Cipher", content: tls + "  cipher_suites:\n    - TLS_RSA_WITH_AES_128_CBC_SHA\n  max_version: TLS12\n", wantErr: "HTTP/2 requires"},
+		{name: "web_config_headers.good", content: "http_server_config:\n  headers:\n    X-Frame-Options: deny\n    Strict-Transport-Security: max-age=31536000; includeSubDomains\n    X-Content-Type-Options: nosniff\n    X-XSS-Protection: 1\n    Content-Security-Policy: \"default-src 'self' *.test.example.net\"\n"},
+		{name: "web_config_headers_content_type_options", content: "http_server_config:\n  headers:\n    X-Content-Type-Options: sniff\n", wantErr: `invalid value "sniff" for X-Content-Type-Options`},
+		{name: "web_config_headers_frame_options", content: "http_server_config:\n  headers:\n    X-Frame-Options: foo\n", wantErr: `invalid value "foo" for X-Frame-Options`},
+		{name: "web_config_headers_extra_header", content: "http_server_config:\n  headers:\n    Content-Type: foo\n", wantErr: "Content-Type cannot be set"},
+		{name: "web_config_noAuth_tlsInline", content: "tls_server_config:\n  cert: x\n  key: y\n", wantErr: "field cert not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, "web.yml")
+			if err := ioutil.WriteFile(file, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := LoadWebConfig(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.TLSConfig.Enabled() && c.TLSConfig.CertFile != filepath.Join(dir, "server.crt") {
+				t.Errorf("got cert_file %s, want it relative to the web config file", c.TLSConfig.CertFile)
+			}
+		})
+	}
+}
+
+// writeKeyPair writes a self-signed certificate and its key.
+func writeKeyPair(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
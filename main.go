@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jenningsloy318/hana_exporter/collector"
 	"github.com/jenningsloy318/hana_exporter/config"
@@ -22,36 +33,451 @@ var (
 		"web.listen-address",
 		"Address to listen on for web interface and telemetry.",
 	).Default(":9460").String()
+	webConfigFile = kingpin.Flag(
+		"web.config.file",
+		"Path to the web configuration file, enabling TLS and basic authentication, in the Prometheus exporter-toolkit format.",
+	).Default("").String()
 	metricPath = kingpin.Flag(
 		"web.telemetry-path",
 		"Path under which to expose metrics.",
 	).Default("/hana").String()
-	configFile = kingpin.Flag("config.file", "Path to configuration file.").Default("hana.yml").String()
-	dsn        string
-	sc         = &config.SafeConfig{
+	configFile          = kingpin.Flag("config.file", "Path to configuration file.").Default("hana.yml").String()
+	configCheck         = kingpin.Flag("config.check", "Validate the configuration file and exit.").Bool()
+	configWatchInterval = kingpin.Flag(
+		"config.watch-interval",
+		"Check the configuration file for changes at this interval and reload it, 0 to reload on SIGHUP and /-/reload only.",
+	).Default("0s").Duration()
+	sdFile = kingpin.Flag(
+		"sd.file",
+		"Write the targets of the configuration file to this file in the Prometheus file_sd format at every reload.",
+	).String()
+	timeoutOffset = kingpin.Flag(
+		"timeout-offset",
+		"Offset to subtract from the timeout requested by Prometheus in seconds.",
+	).Default("0.25").Float64()
+	poolIdleTimeout = kingpin.Flag(
+		"pool.idle-timeout",
+		"Close the connections to a target, and forget its state, once it has not been scraped for this duration.",
+	).Default("5m").Duration()
+	poolMaxOpenConns = kingpin.Flag(
+		"pool.max-open-connections",
+		"Maximum number of open connections per target.",
+	).Default("3").Int()
+	pollInterval = kingpin.Flag(
+		"poll.interval",
+		"Poll the targets of the config file in the background at this interval and serve the cached metrics, 0 to scrape on request.",
+	).Default("0s").Duration()
+	scrapeReuseWindow = kingpin.Flag(
+		"scrape.reuse-window",
+		"Serve the result of a scrape to the scrapes of the same target and collectors starting within this duration after it finished, concurrent scrapes always share one execution.",
+	).Default("0s").Duration()
+	breakerFailures = kingpin.Flag(
+		"breaker.failures",
+		"Consecutive connection failures after which scrapes of a target fail immediately until the backoff has passed, 0 to disable.",
+	).Default("3").Int()
+	breakerBackoff = kingpin.Flag(
+		"breaker.backoff",
+		"Initial backoff of an unreachable target, doubled after every failed probe.",
+	).Default("10s").Duration()
+	breakerMaxBackoff = kingpin.Flag(
+		"breaker.max-backoff",
+		"Maximum backoff of an unreachable target, 0 for no limit.",
+	).Default("5m").Duration()
+	dsn string
+	sc  = &config.SafeConfig{
 		C: &config.Config{},
 	}
 	reloadCh chan chan error
+	pool     *collector.Pool
+	targets  *collector.TargetRegistry
+	poller   *collector.Poller
+	group    *collector.ScrapeGroup
 )
 
 // scrapers lists all possible collection methods and if they should be enabled by default.
 var scrapers = map[collector.Scraper]bool{
-	collector.ScrapeHostResourceUtilization{}: true,
-	collector.ScrapeServiceStatistics{}:       true,
-	collector.ScrapeLicenseStatus{}:           true,
-	collector.ScrapeDisks{}:                   true,
-	collector.ScrapeSharedMemory{}:            true,
-	collector.ScrapeCsTables{}:                true,
-	collector.ScrapeServiceReplication{}:      true,
-	collector.ScrapeSystemConfig{}:            true,
-	collector.ScrapeSystemReplication{}:       true,
-	collector.ScrapeCsUnloads{}:               true,
-	collector.ScrapeCsLoads{}:                 true,
-	collector.ScrapeRsTables{}:                true,
+	collector.ScrapeHostResourceUtilization: true,
+	collector.ScrapeServiceStatistics:       true,
+	collector.ScrapeLicenseStatus:           true,
+	collector.ScrapeDisks:                   true,
+	collector.ScrapeSharedMemory:            true,
+	collector.ScrapeCsTables:                true,
+	collector.ScrapeServiceReplication:      true,
+	collector.ScrapeSystemConfig:            true,
+	collector.ScrapeSystemReplication:       true,
+	collector.ScrapeCsUnloads:               true,
+	collector.ScrapeCsLoads:                 true,
+	collector.ScrapeRsTables:                true,
 }
 
+// Metrics about the config file.
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hana",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "hana",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
 func init() {
 	prometheus.MustRegister(version.NewCollector("hana_exporter"))
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+}
+
+// customQuery is a custom query of the config file with its scraper.
+type customQuery struct {
+	scraper *collector.QueryScraper
+	config  config.QueryConfig
+}
+
+// customQueries are the custom queries of the config file, sorted by name.
+// They are rebuilt on every reload of the config file.
+var customQueries struct {
+	sync.RWMutex
+	queries []customQuery
+}
+
+// reloadConfig reloads the config file and rebuilds the custom queries.
+func reloadConfig() error {
+	if err := loadConfig(); err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+// loadConfig loads the config file and builds the custom queries. The
+// config is only replaced when all of its queries are valid.
+func loadConfig() error {
+	var queries []customQuery
+	err := sc.ReloadConfig(*configFile, func(c *config.Config) error {
+		var err error
+		queries, err = checkConfig(c)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	customQueries.Lock()
+	customQueries.queries = queries
+	customQueries.Unlock()
+	return nil
+}
+
+// buildQueries returns the scrapers of the custom queries of c, sorted by
+// name, and the errors of the queries which could not be built.
+func buildQueries(c *config.Config) ([]customQuery, error) {
+	names := make([]string, 0, len(c.Queries))
+	for name := range c.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	queries := make([]customQuery, 0, len(names))
+	var errs []error
+	for _, name := range names {
+		scraper, err := collector.NewQueryScraper(name, c.Queries[name])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		queries = append(queries, customQuery{scraper: scraper, config: c.Queries[name]})
+	}
+	return queries, config.JoinErrors(errs...)
+}
+
+// checkConfig checks the collector names of c against the built-in
+// collectors and its custom queries, the metric names of its custom queries
+// against the other metrics, and the labels of its databases against the
+// labels of the metrics. It returns the built custom queries. All the checks
+// run, their errors are returned together.
+func checkConfig(c *config.Config) ([]customQuery, error) {
+	collectorsErr := c.CheckCollectors(func(name string) bool {
+		_, ok := builtinScraperByName(name)
+		return ok
+	})
+	queries, queriesErr := buildQueries(c)
+	all := make([]collector.Scraper, 0, len(scrapers)+len(queries))
+	for scraper := range scrapers {
+		all = append(all, scraper)
+	}
+	for _, query := range queries {
+		all = append(all, query.scraper)
+	}
+	labelsErr := c.CheckLabels(collector.LabelNames(all))
+	metricsErr := c.CheckMetricNames(reservedMetricNames(), queryMetricNames(queries))
+	if err := config.JoinErrors(collectorsErr, queriesErr, labelsErr, metricsErr); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// reservedMetricNames returns the names of the metrics served along with the
+// custom queries: those of the exporter and the built-in collectors, and
+// those of the default registry.
+func reservedMetricNames() []string {
+	builtin := make([]collector.Scraper, 0, len(scrapers))
+	for scraper := range scrapers {
+		builtin = append(builtin, scraper)
+	}
+	names := collector.MetricNames(builtin)
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		log.Errorf("Error gathering the default metrics: %s", err)
+	}
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	return names
+}
+
+// queryMetricNames returns the names of the metrics of each custom query.
+func queryMetricNames(queries []customQuery) map[string][]string {
+	names := make(map[string][]string, len(queries))
+	for _, query := range queries {
+		names[query.scraper.Name()] = query.scraper.MetricNames()
+	}
+	return names
+}
+
+// builtinScraperByName returns the built-in scraper of the given name.
+func builtinScraperByName(name string) (collector.Scraper, bool) {
+	for scraper := range scrapers {
+		if scraper.Name() == name {
+			return scraper, true
+		}
+	}
+	return nil, false
+}
+
+// scraperByName returns the built-in scraper or custom query of the given
+// name. known is false if there is no collector of that name, ok is false for
+// custom queries which do not apply to the target and module.
+func scraperByName(name, target, module string) (scraper collector.Scraper, ok, known bool) {
+	if scraper, ok = builtinScraperByName(name); ok {
+		return scraper, true, true
+	}
+	customQueries.RLock()
+	defer customQueries.RUnlock()
+	for _, query := range customQueries.queries {
+		if query.scraper.Name() == name {
+			return query.scraper, query.config.AppliesTo(target, module), true
+		}
+	}
+	return nil, false, false
+}
+
+// scrapersForModule returns the collectors run for target by the given
+// module, scrapers are the collectors enabled by flag.
+func scrapersForModule(scrapers []collector.Scraper, target, moduleName string, module config.ModuleConfig) ([]collector.Scraper, error) {
+	var moduleScrapers []collector.Scraper
+	if len(module.Collectors) > 0 {
+		for _, name := range module.Collectors {
+			scraper, ok, known := scraperByName(name, target, moduleName)
+			if !known {
+				return nil, fmt.Errorf("module %s lists unknown collector '%s'", moduleName, name)
+			}
+			if ok {
+				moduleScrapers = append(moduleScrapers, scraper)
+			}
+		}
+		return moduleScrapers, nil
+	}
+	moduleScrapers = append(moduleScrapers, scrapers...)
+	customQueries.RLock()
+	defer customQueries.RUnlock()
+	for _, query := range customQueries.queries {
+		if query.config.AppliesTo(target, moduleName) {
+			moduleScrapers = append(moduleScrapers, query.scraper)
+		}
+	}
+	return moduleScrapers, nil
+}
+
+// cachedCollector returns the collector serving the cached metrics of target
+// when polling in the background.
+func cachedCollector(target, module string, scrapers []collector.Scraper) (prometheus.Collector, bool) {
+	if poller == nil {
+		return nil, false
+	}
+	return poller.Collector(target, module, scrapers)
+}
+
+// updatePoller polls the targets of the config file with the collectors of
+// their module, scrapers are the collectors enabled by flag.
+func updatePoller(scrapers []collector.Scraper) {
+	sc.RLock()
+	databases := make(map[string]config.DatabaseConfig, len(sc.C.Databases))
+	for name, databaseConfig := range sc.C.Databases {
+		databases[name] = databaseConfig
+	}
+	sc.RUnlock()
+
+	var pollTargets []collector.PollTarget
+	for target, databaseConfig := range databases {
+		// The default credentials and the patterns are not a target.
+		if !config.IsTarget(target, databaseConfig) {
+			continue
+		}
+		module, err := sc.ModuleConfig(databaseConfig.Module)
+		if err != nil {
+			log.Errorf("Not polling target %s: %s", target, err)
+			continue
+		}
+		moduleScrapers, err := scrapersForModule(scrapers, target, databaseConfig.Module, module)
+		if err != nil {
+			log.Errorf("Not polling target %s: %s", target, err)
+			continue
+		}
+		pollTargets = append(pollTargets, collector.PollTarget{
+			Name:           target,
+			DatabaseConfig: databaseConfig,
+			Module:         databaseConfig.Module,
+			Scrapers:       moduleScrapers,
+			Timeout:        module.Timeout,
+			Collectors:     module.CollectorConfigs,
+		})
+	}
+	poller.Update(pollTargets)
+}
+
+// watchConfig reloads the config file whenever its content changes, checked
+// every interval.
+func watchConfig(interval time.Duration) {
+	last, err := configChecksum()
+	if err != nil {
+		log.Errorf("Error watching config file: %s", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sum, err := configChecksum()
+		if err != nil {
+			log.Errorf("Error watching config file: %s", err)
+			continue
+		}
+		if sum == last {
+			continue
+		}
+		last = sum
+		log.Infoln("Config file changed, reloading")
+		rc := make(chan error)
+		reloadCh <- rc
+		<-rc
+	}
+}
+
+// configChecksum returns the checksum of the content of the config file.
+func configChecksum() ([sha256.Size]byte, error) {
+	content, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
+
+// sdHandler serves the targets of the config file in the Prometheus HTTP
+// service discovery format.
+func sdHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sc.TargetGroups()); err != nil {
+		log.Errorf("Error encoding targets: %s", err)
+	}
+}
+
+// writeSDFile writes the targets of the config file to path in the
+// Prometheus file_sd format. The file is replaced atomically, so that
+// Prometheus never reads a partial file.
+func writeSDFile(path string) error {
+	content, err := json.MarshalIndent(sc.TargetGroups(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// matchHandler explains which key of the databases section holds the
+// settings of the target parameter.
+func matchHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "'target' parameter must be specified", 400)
+		return
+	}
+	matches := sc.MatchTarget(target)
+	used := ""
+	for _, match := range matches {
+		if match.Matched {
+			used = match.Key
+			break
+		}
+	}
+	if used == "" {
+		fmt.Fprintf(w, "No database matches target %s.\n\n", target)
+	} else {
+		fmt.Fprintf(w, "Target %s uses database %s.\n\n", target, used)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATABASE\tKIND\tMATCH")
+	for _, match := range matches {
+		result := "no"
+		if match.Matched {
+			result = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", match.Key, match.Kind, result)
+	}
+	tw.Flush()
+}
+
+// scrapeTimeout returns the timeout of a scrape, the shorter of the
+// Prometheus scrape timeout less --timeout-offset and the timeout of the
+// module, 0 if there is none.
+func scrapeTimeout(r *http.Request, module config.ModuleConfig) time.Duration {
+	var timeout time.Duration
+	// If a timeout is configured via the Prometheus header, use it.
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		timeoutSeconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Errorf("Failed to parse timeout from Prometheus header: %s", err)
+		} else {
+			if *timeoutOffset >= timeoutSeconds {
+				// Ignore timeout offset if it doesn't leave time to scrape.
+				log.Errorf("Timeout offset (--timeout-offset=%.2f) should be lower than prometheus scrape timeout (%.2f)", *timeoutOffset, timeoutSeconds)
+			} else {
+				timeoutSeconds -= *timeoutOffset
+			}
+			timeout = time.Duration(timeoutSeconds * float64(time.Second))
+		}
+	}
+	if module.Timeout > 0 && (timeout <= 0 || module.Timeout < timeout) {
+		timeout = module.Timeout
+	}
+	return timeout
 }
 
 // define new http handleer
@@ -70,10 +496,78 @@ func newHandler(scrapers []collector.Scraper) http.HandlerFunc {
 			return
 		}
 
+		// The module parameter takes precedence over the module of the target.
+		moduleName := r.URL.Query().Get("module")
+		if moduleName == "" {
+			moduleName = databaseConfig.Module
+		}
+		module, err := sc.ModuleConfig(moduleName)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		moduleScrapers, err := scrapersForModule(scrapers, target, moduleName, module)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+
+		// Run only the collectors listed in the collect[] parameters, if any.
+		filteredScrapers := moduleScrapers
+		if collect := r.URL.Query()["collect[]"]; len(collect) > 0 {
+			enabled := make(map[string]collector.Scraper, len(moduleScrapers))
+			for _, scraper := range moduleScrapers {
+				enabled[scraper.Name()] = scraper
+			}
+			filteredScrapers = nil
+			seen := make(map[string]bool, len(collect))
+			for _, name := range collect {
+				scraper, ok := enabled[name]
+				if !ok {
+					http.Error(w, fmt.Sprintf("collector '%s' is unknown or not enabled", name), 400)
+					return
+				}
+				if !seen[name] {
+					seen[name] = true
+					filteredScrapers = append(filteredScrapers, scraper)
+				}
+			}
+		}
+
+		ctx := r.Context()
+		if timeout := scrapeTimeout(r, module); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
 		registry := prometheus.NewRegistry()
+		// The labels of the target are added to all of its metrics.
+		registerer := prometheus.WrapRegistererWith(databaseConfig.Labels, registry)
 
-		collector := collector.New(target, databaseConfig.User, databaseConfig.Password, scrapers)
-		registry.MustRegister(collector)
+		// Serve the cached metrics of polled targets, other modules and
+		// collectors are scraped on request.
+		var c prometheus.Collector
+		if cached, ok := cachedCollector(target, moduleName, filteredScrapers); ok {
+			c = cached
+		} else {
+			t, release := targets.Get(target)
+			defer release()
+			c = group.Collector(collector.New(ctx, pool, t, databaseConfig, filteredScrapers, module.CollectorConfigs))
+		}
+		// The descriptors are checked for consistency, e.g. the labels of
+		// the target must not clash with the labels of the metrics.
+		if err := registerer.Register(c); err != nil {
+			log.Errorf("Error registering the collectors of target %s: %s", target, err)
+			http.Error(w, fmt.Sprintf("registering the collectors of target %s: %s", target, err), 500)
+			return
+		}
+		// The pool statistics of the target alone, or of its candidate hosts.
+		if err := registerer.Register(pool.Collector(append([]string{target}, databaseConfig.Hosts...)...)); err != nil {
+			log.Errorf("Error registering the pool statistics of target %s: %s", target, err)
+			http.Error(w, fmt.Sprintf("registering the pool statistics of target %s: %s", target, err), 500)
+			return
+		}
 
 		gatherers := prometheus.Gatherers{
 			prometheus.DefaultGatherer,
@@ -108,10 +602,52 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
-	if err := sc.ReloadConfig(*configFile); err != nil {
+	if *configCheck {
+		ok := true
+		_, err := config.LoadFile(*configFile, func(c *config.Config) error {
+			_, err := checkConfig(c)
+			return err
+		})
+		if err != nil {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, line)
+			}
+			ok = false
+		} else {
+			fmt.Printf("%s: OK\n", *configFile)
+		}
+		if *webConfigFile != "" {
+			if _, err := config.LoadWebConfig(*webConfigFile); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", *webConfigFile, err)
+				ok = false
+			} else {
+				fmt.Printf("%s: OK\n", *webConfigFile)
+			}
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if err := reloadConfig(); err != nil {
 		log.Fatalf("Error parsing config file: %s", err)
 	}
 
+	if *sdFile != "" {
+		if err := writeSDFile(*sdFile); err != nil {
+			log.Errorf("Error writing service discovery file: %s", err)
+		}
+	}
+
+	targets = collector.NewTargetRegistry(collector.BreakerConfig{
+		Failures:   *breakerFailures,
+		Backoff:    *breakerBackoff,
+		MaxBackoff: *breakerMaxBackoff,
+	}, *poolIdleTimeout)
+	pool = collector.NewPool(*poolIdleTimeout, *poolMaxOpenConns)
+	group = collector.NewScrapeGroup(*scrapeReuseWindow)
+
 	// landingPage contains the HTML served at '/'.
 	// TODO: Make this nicer and more informative.
 	var landingPage = []byte(`<html>
@@ -136,35 +672,67 @@ func main() {
 		}
 	}
 
+	if *pollInterval > 0 {
+		poller = collector.NewPoller(pool, targets, *pollInterval)
+		updatePoller(enabledScrapers)
+	}
+
 	// load config  first time
-	hup := make(chan os.Signal)
+	hup := make(chan os.Signal, 1)
 	reloadCh = make(chan chan error)
 	signal.Notify(hup, syscall.SIGHUP)
 
+	reload := func() error {
+		if err := reloadConfig(); err != nil {
+			log.Errorf("Error reloading config: %s", err)
+			return err
+		}
+		if poller != nil {
+			updatePoller(enabledScrapers)
+		}
+		if *sdFile != "" {
+			if err := writeSDFile(*sdFile); err != nil {
+				log.Errorf("Error writing service discovery file: %s", err)
+			}
+		}
+		return nil
+	}
 	go func() {
 		for {
 			select {
 			case <-hup:
-				if err := sc.ReloadConfig(*configFile); err != nil {
-					log.Errorf("Error reloading config: %s", err)
-				}
+				reload()
 			case rc := <-reloadCh:
-				if err := sc.ReloadConfig(*configFile); err != nil {
-					log.Errorf("Error reloading config: %s", err)
-					rc <- err
-				} else {
-					rc <- nil
-				}
+				rc <- reload()
 			}
 		}
 	}()
+	if *configWatchInterval > 0 {
+		go watchConfig(*configWatchInterval)
+	}
 
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc(*metricPath, newHandler(enabledScrapers))
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "This endpoint requires a POST request.\n")
+			return
+		}
+
+		rc := make(chan error)
+		reloadCh <- rc
+		if err := <-rc; err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	})
+	http.HandleFunc("/-/match", matchHandler)
+	http.HandleFunc("/sd", sdHandler)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write(landingPage)
 	})
 
 	log.Infoln("Listening on", *listenAddress)
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	server := &webServer{file: *webConfigFile}
+	log.Fatal(server.listenAndServe(*listenAddress, http.DefaultServeMux))
 }
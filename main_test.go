@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/collector"
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeConfig writes a config file with the given content to a temporary
+// directory, removed by the returned function.
+func writeConfig(t *testing.T, content string) (file string, remove func()) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file = filepath.Join(dir, "hana.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestCheckConfigMetricNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries string
+		errs    []string
+	}{
+		{
+			name: "distinct",
+			queries: `  app_sessions:
+    sql: SELECT
+    values: [count]
+  app_jobs:
+    sql: SELECT
+    values: [count]
+`,
+		},
+		{
+			name: "built-in collector",
+			queries: `  sys_m_disks_total:
+    sql: SELECT
+    values: [size]
+`,
+			errs: []string{"line 2: query sys_m_disks_total: metric hana_sys_m_disks_total_size is reserved by the exporter"},
+		},
+		{
+			name: "exporter",
+			queries: `  exporter:
+    sql: SELECT
+    values: [scrapes_total, config_last_reload_successful]
+`,
+			errs: []string{
+				"line 2: query exporter: metric hana_exporter_scrapes_total is reserved by the exporter",
+				"line 2: query exporter: metric hana_exporter_config_last_reload_successful is reserved by the exporter",
+			},
+		},
+		{
+			name: "other query",
+			queries: `  app:
+    sql: SELECT
+    values: [jobs_count]
+  app_jobs:
+    sql: SELECT
+    values: [count]
+`,
+			errs: []string{"line 5: query app_jobs: metric hana_app_jobs_count is also exported by query app"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, remove := writeConfig(t, "queries:\n"+test.queries)
+			defer remove()
+			_, err := config.LoadFile(file, func(c *config.Config) error {
+				_, err := checkConfig(c)
+				return err
+			})
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := strings.Split(err.Error(), "\n"); strings.Join(got, "\n") != strings.Join(test.errs, "\n") {
+				t.Errorf("got errors %q, want %q", got, test.errs)
+			}
+		})
+	}
+}
+
+// sdConfig is a config file with a target, a target with a module and
+// labels, and patterns left out of the service discovery.
+const sdConfig = `databases:
+  hana2:30015:
+    user: SYSTEM
+    module: quick
+    labels:
+      env: prod
+  hana1:30015:
+    user: SYSTEM
+  hana*:30015:
+    user: SYSTEM
+  default:
+    user: SYSTEM
+modules:
+  quick:
+    collectors: [sys_m_disks]
+`
+
+// sdTargets are the target groups of sdConfig.
+const sdTargets = `[{"targets":["hana1:30015"]},{"targets":["hana2:30015"],"labels":{"__param_module":"quick","env":"prod"}}]`
+
+// useConfig loads the config file with the given content into sc, restored
+// by the returned function.
+func useConfig(t *testing.T, content string) (restore func()) {
+	file, remove := writeConfig(t, content)
+	defer remove()
+	c, err := config.LoadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Lock()
+	previous := sc.C
+	sc.C = c
+	sc.Unlock()
+	return func() {
+		sc.Lock()
+		sc.C = previous
+		sc.Unlock()
+	}
+}
+
+func TestSDHandler(t *testing.T) {
+	defer useConfig(t, sdConfig)()
+
+	w := httptest.NewRecorder()
+	sdHandler(w, httptest.NewRequest("GET", "/sd", nil))
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %s, want application/json", got)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != sdTargets {
+		t.Errorf("got %s, want %s", got, sdTargets)
+	}
+}
+
+func TestWriteSDFile(t *testing.T) {
+	defer useConfig(t, sdConfig)()
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.json")
+	if err := ioutil.WriteFile(path, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeSDFile(path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []config.TargetGroup
+	if err := json.Unmarshal(content, &groups); err != nil {
+		t.Fatalf("the file is not file_sd JSON: %s", err)
+	}
+	if got, _ := json.Marshal(groups); string(got) != sdTargets {
+		t.Errorf("got %s, want %s", got, sdTargets)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("got mode %s, want it readable by Prometheus", info.Mode())
+	}
+	// The file is replaced by renaming a temporary file, which is gone.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files, want only the targets file", len(files))
+	}
+}
+
+// fakeScraper records the scrapers selected by a handler, which describes
+// them when registering the exporter. It implements collector.Scraper.
+type fakeScraper struct {
+	name      string
+	described *describedScrapers
+}
+
+// describedScrapers are the names of the described scrapers.
+type describedScrapers struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (s fakeScraper) Name() string { return s.name }
+
+func (s fakeScraper) Help() string { return "Fake." }
+
+func (s fakeScraper) Describe(chan<- *prometheus.Desc) {
+	s.described.mu.Lock()
+	s.described.names = append(s.described.names, s.name)
+	s.described.mu.Unlock()
+}
+
+func (s fakeScraper) Scrape(context.Context, *collector.Instance, chan<- prometheus.Metric) error {
+	return nil
+}
+
+// useHandler sets up the state of the scrape handler, with the fake
+// scrapers of the given names as built-in collectors. The target
+// 127.0.0.1:1 refuses the connections.
+func useHandler(t *testing.T, content string, names ...string) (described *describedScrapers, restore func()) {
+	restoreConfig := useConfig(t, content)
+	previousPool, previousTargets, previousGroup := pool, targets, group
+	pool = collector.NewPool(0, 1)
+	targets = collector.NewTargetRegistry(collector.BreakerConfig{}, 0)
+	group = collector.NewScrapeGroup(0)
+	described = &describedScrapers{}
+	var fakes []collector.Scraper
+	for _, name := range names {
+		fake := fakeScraper{name: name, described: described}
+		scrapers[fake] = false
+		fakes = append(fakes, fake)
+	}
+	return described, func() {
+		for _, fake := range fakes {
+			delete(scrapers, fake)
+		}
+		pool, targets, group = previousPool, previousTargets, previousGroup
+		restoreConfig()
+	}
+}
+
+// handlerConfig is a config file with the target of useHandler and
+// modules of fake scrapers.
+const handlerConfig = `databases:
+  127.0.0.1:1:
+    user: SYSTEM
+    pass: secret
+modules:
+  ab:
+    collectors: [fake_a, fake_b]
+`
+
+func TestHandlerCollect(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// want are the collectors run, in order.
+		want       []string
+		wantStatus int
+		wantErr    string
+	}{
+		{
+			name:       "all enabled",
+			query:      "target=127.0.0.1:1",
+			want:       []string{"fake_a", "fake_c"},
+			wantStatus: 200,
+		},
+		{
+			name:       "collect[]",
+			query:      "target=127.0.0.1:1&collect[]=fake_c",
+			want:       []string{"fake_c"},
+			wantStatus: 200,
+		},
+		{
+			name:       "repeated collect[]",
+			query:      "target=127.0.0.1:1&collect[]=fake_c&collect[]=fake_a&collect[]=fake_c",
+			want:       []string{"fake_c", "fake_a"},
+			wantStatus: 200,
+		},
+		{
+			name:       "unknown collector",
+			query:      "target=127.0.0.1:1&collect[]=fake_x",
+			wantStatus: 400,
+			wantErr:    "collector 'fake_x' is unknown or not enabled",
+		},
+		{
+			name:       "collector not enabled",
+			query:      "target=127.0.0.1:1&collect[]=fake_b",
+			wantStatus: 400,
+			wantErr:    "collector 'fake_b' is unknown or not enabled",
+		},
+		{
+			name:       "collect[] and module",
+			query:      "target=127.0.0.1:1&module=ab&collect[]=fake_b",
+			want:       []string{"fake_b"},
+			wantStatus: 200,
+		},
+		{
+			name:       "collect[] not in module",
+			query:      "target=127.0.0.1:1&module=ab&collect[]=fake_c",
+			wantStatus: 400,
+			wantErr:    "collector 'fake_c' is unknown or not enabled",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			described, restore := useHandler(t, handlerConfig, "fake_a", "fake_b", "fake_c")
+			defer restore()
+			// fake_b is only run by the module.
+			enabled := []collector.Scraper{
+				fakeScraper{name: "fake_a", described: described},
+				fakeScraper{name: "fake_c", described: described},
+			}
+
+			w := httptest.NewRecorder()
+			newHandler(enabled)(w, httptest.NewRequest("GET", "/metrics?"+test.query, nil))
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantErr != "" {
+				if !strings.Contains(w.Body.String(), test.wantErr) {
+					t.Errorf("got %q, want %q", w.Body, test.wantErr)
+				}
+				return
+			}
+			if strings.Join(described.names, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got collectors %q, want %q", described.names, test.want)
+			}
+		})
+	}
+}
+
+func TestHandlerModule(t *testing.T) {
+	content := `databases:
+  127.0.0.1:1:
+    user: SYSTEM
+    pass: secret
+    module: ab
+  127.0.0.2:1:
+    user: SYSTEM
+    pass: secret
+modules:
+  ab:
+    collectors: [fake_a, fake_b]
+  c:
+    collectors: [fake_c]
+  unknown:
+    collectors: [fake_x]
+`
+	tests := []struct {
+		name       string
+		query      string
+		want       []string
+		wantStatus int
+		wantErr    string
+	}{
+		{
+			name:       "default module of the target",
+			query:      "target=127.0.0.1:1",
+			want:       []string{"fake_a", "fake_b"},
+			wantStatus: 200,
+		},
+		{
+			name:       "module parameter",
+			query:      "target=127.0.0.1:1&module=c",
+			want:       []string{"fake_c"},
+			wantStatus: 200,
+		},
+		{
+			name:       "no module",
+			query:      "target=127.0.0.2:1",
+			want:       []string{"fake_a"},
+			wantStatus: 200,
+		},
+		{
+			name:       "unknown module",
+			query:      "target=127.0.0.1:1&module=x",
+			wantStatus: 400,
+			wantErr:    "unknown module x",
+		},
+		{
+			name:       "unknown collector of the module",
+			query:      "target=127.0.0.1:1&module=unknown",
+			wantStatus: 500,
+			wantErr:    "module unknown lists unknown collector 'fake_x'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			described, restore := useHandler(t, content, "fake_a", "fake_b", "fake_c")
+			defer restore()
+			enabled := []collector.Scraper{fakeScraper{name: "fake_a", described: described}}
+
+			w := httptest.NewRecorder()
+			newHandler(enabled)(w, httptest.NewRequest("GET", "/metrics?"+test.query, nil))
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantErr != "" {
+				if !strings.Contains(w.Body.String(), test.wantErr) {
+					t.Errorf("got %q, want %q", w.Body, test.wantErr)
+				}
+				return
+			}
+			if strings.Join(described.names, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got collectors %q, want %q", described.names, test.want)
+			}
+		})
+	}
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	previous := *timeoutOffset
+	*timeoutOffset = 0.5
+	defer func() { *timeoutOffset = previous }()
+
+	tests := []struct {
+		name          string
+		header        string
+		moduleTimeout time.Duration
+		want          time.Duration
+	}{
+		{name: "none"},
+		{name: "header less offset", header: "10", want: 9500 * time.Millisecond},
+		{name: "offset not leaving time to scrape", header: "0.5", want: 500 * time.Millisecond},
+		{name: "invalid header", header: "x"},
+		{name: "module", moduleTimeout: 5 * time.Second, want: 5 * time.Second},
+		{name: "module shorter", header: "10", moduleTimeout: 5 * time.Second, want: 5 * time.Second},
+		{name: "header shorter", header: "3", moduleTimeout: 5 * time.Second, want: 2500 * time.Millisecond},
+		{name: "invalid header and module", header: "x", moduleTimeout: 5 * time.Second, want: 5 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if test.header != "" {
+				r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", test.header)
+			}
+			if got := scrapeTimeout(r, config.ModuleConfig{Timeout: test.moduleTimeout}); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
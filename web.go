@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxAuthCacheSize bounds the number of cached successful logins.
+const maxAuthCacheSize = 100
+
+// webServer serves the HTTP endpoints with the TLS and basic authentication
+// of the web config file. The file is read again when it or one of its TLS
+// files is modified, so that renewed certificates and changed users apply
+// without a restart.
+type webServer struct {
+	file string
+
+	mu sync.Mutex
+	// config and tlsConfig are the last loaded web config and its server
+	// TLS config, nil without TLS. modTimes are the modification times of
+	// the files they were loaded from.
+	config    *config.WebConfig
+	tlsConfig *tls.Config
+	modTimes  []time.Time
+	// authCache holds the checksums of the successful logins, since bcrypt
+	// is slow by design.
+	authCache map[[sha256.Size]byte]bool
+}
+
+// load returns the web config and its server TLS config, read again only
+// when the web config file or one of its TLS files was modified.
+func (s *webServer) load() (*config.WebConfig, *tls.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config != nil && equalTimes(modTimes(s.files(s.config)), s.modTimes) {
+		return s.config, s.tlsConfig, nil
+	}
+
+	c, err := config.LoadWebConfig(s.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tlsConfig *tls.Config
+	if c.TLSConfig.Enabled() {
+		if tlsConfig, err = c.TLSConfig.ServerConfig(); err != nil {
+			return nil, nil, err
+		}
+	}
+	s.config, s.tlsConfig, s.modTimes = c, tlsConfig, modTimes(s.files(c))
+	return c, tlsConfig, nil
+}
+
+// files returns the files the web config c is loaded from.
+func (s *webServer) files(c *config.WebConfig) []string {
+	if s.file == "" {
+		return nil
+	}
+	return []string{s.file, c.TLSConfig.CertFile, c.TLSConfig.KeyFile, c.TLSConfig.ClientCAFile}
+}
+
+// modTimes returns the modification times of files, zero for files which
+// are not set or cannot be read.
+func modTimes(files []string) []time.Time {
+	times := make([]time.Time, len(files))
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// equalTimes reports whether a and b hold the same times.
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// dummyHash is compared to the password of unknown users, so that they take
+// as long to reject as known users.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("hana_exporter"), bcrypt.DefaultCost)
+
+// handler requires the basic authentication of the web config file, if
+// any, before serving the requests with next.
+func (s *webServer) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _, err := s.load()
+		if err != nil {
+			log.Errorf("Error loading web config file: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		for name, value := range c.HTTPConfig.Headers {
+			w.Header().Set(name, value)
+		}
+		if len(c.Users) > 0 && !s.authorized(c, r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="hana_exporter"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the credentials of a user of c.
+func (s *webServer) authorized(c *config.WebConfig, r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, known := c.Users[user]
+	if !known {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+	s.mu.Lock()
+	cached := s.authCache[key]
+	s.mu.Unlock()
+	if cached {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	s.mu.Lock()
+	if len(s.authCache) >= maxAuthCacheSize {
+		s.authCache = nil
+	}
+	if s.authCache == nil {
+		s.authCache = make(map[[sha256.Size]byte]bool)
+	}
+	s.authCache[key] = true
+	s.mu.Unlock()
+	return true
+}
+
+// listenAndServe serves handler on address, with TLS when the web config
+// file configures it.
+func (s *webServer) listenAndServe(address string, handler http.Handler) error {
+	c, tlsConfig, err := s.load()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: address, Handler: s.handler(handler)}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	// HTTP/2 is negotiated with ALPN, it can only be turned on or off with
+	// a restart.
+	nextProtos := []string{"h2", "http/1.1"}
+	if !c.HTTPConfig.HTTP2Enabled() {
+		nextProtos = []string{"http/1.1"}
+		// A non-nil empty map disables HTTP/2.
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	server.TLSConfig = &tls.Config{
+		// The certificate and the client CAs are read again once modified.
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, tlsConfig, err := s.load()
+			if err != nil {
+				log.Errorf("Error loading web config file: %s", err)
+				return nil, err
+			}
+			if tlsConfig == nil {
+				err := fmt.Errorf("TLS cannot be disabled without a restart")
+				log.Errorf("Error loading web config file: %s", err)
+				return nil, err
+			}
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.NextProtos = nextProtos
+			return tlsConfig, nil
+		},
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Infoln("TLS is enabled")
+	return server.Serve(tls.NewListener(listener, server.TLSConfig))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenningsloy318/hana_exporter/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthorized(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &config.WebConfig{Users: map[string]string{"prometheus": string(hash)}}
+
+	tests := []struct {
+		name           string
+		user, password string
+		noAuth         bool
+		want           bool
+	}{
+		{name: "no credentials", noAuth: true},
+		{name: "unknown user", user: "other", password: "secret"},
+		{name: "wrong password", user: "prometheus", password: "wrong"},
+		{name: "empty password", user: "prometheus"},
+		{name: "valid", user: "prometheus", password: "secret", want: true},
+		// The second login is served from the cache.
+		{name: "valid again", user: "prometheus", password: "secret", want: true},
+		{name: "wrong password after a valid login", user: "prometheus", password: "secret2"},
+	}
+	s := &webServer{}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if !test.noAuth {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		if got := s.authorized(c, r); got != test.want {
+			t.Errorf("%s: authorized = %t, want %t", test.name, got, test.want)
+		}
+	}
+	if len(s.authCache) != 1 {
+		t.Errorf("%d cached logins, want 1", len(s.authCache))
+	}
+
+	// A changed hash is not served from the cache of the old one.
+	other, err := bcrypt.GenerateFromPassword([]byte("rotated"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Users["prometheus"] = string(other)
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.SetBasicAuth("prometheus", "secret")
+	if s.authorized(c, r) {
+		t.Error("the old password is accepted after a change of the hash")
+	}
+}
+
+func TestHandlerBasicAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hana_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "web.yml")
+	if err := ioutil.WriteFile(file, []byte("basic_auth_users:\n  prometheus: "+string(hash)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &webServer{file: file}
+	h := s.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "wrong password", password: "wrong", want: http.StatusUnauthorized},
+		{name: "valid", password: "secret", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if test.password != "" {
+			r.SetBasicAuth("prometheus", test.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, w.Code, test.want)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", test.name)
+		}
+	}
+}